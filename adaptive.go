@@ -0,0 +1,56 @@
+package consistenthash
+
+import "sync/atomic"
+
+const (
+	// minBlockOccupancy minimum average number of keys per block kept by adaptive blocks
+	minBlockOccupancy = 4
+	// maxBlockOccupancy maximum average number of keys per block kept by adaptive blocks
+	maxBlockOccupancy = 16
+	// adaptInterval minimum number of lookups between adapting the block partitioning
+	adaptInterval = 1024
+	// highMissRate miss rate above which the blocks are made bigger
+	highMissRate = 0.2
+	// lowMissRate miss rate below which the blocks are made smaller
+	lowMissRate = 0.05
+)
+
+// adaptBlocks adapts the block partitioning to the miss rate and resizes the blocks when the partitioning is changed
+// or the average number of keys per block is out of range with the given total keys, the write lock must be held
+func (ch *ConsistentHash) adaptBlocks(totalKeys uint32) {
+	changed := ch.adaptPartitioning()
+	expectedBlocks := totalKeys / ch.blockPartitioning
+	if expectedBlocks == 0 || expectedBlocks == ch.totalBlocks {
+		return
+	}
+	blocks := uint64(ch.totalBlocks)
+	if changed || uint64(totalKeys) < minBlockOccupancy*blocks || uint64(totalKeys) > maxBlockOccupancy*blocks {
+		ch.resizeBlocks(expectedBlocks)
+	}
+}
+
+// adaptPartitioning doubles the block partitioning when Get often misses the block of the hash, as the blocks are often empty,
+// and halves it when it rarely misses to keep the blocks small, returns whether it's changed
+// it's checked at most once every adaptInterval lookups, using the miss rate since the last check
+// the partitioning stays between minBlockOccupancy and half of maxBlockOccupancy, so the blocks can grow before they are resized
+func (ch *ConsistentHash) adaptPartitioning() bool {
+	lookups, misses := atomic.LoadUint64(&ch.lookups), atomic.LoadUint64(&ch.misses)
+	if lookups-ch.adaptedLookups < adaptInterval {
+		return false
+	}
+	rate := float64(misses-ch.adaptedMisses) / float64(lookups-ch.adaptedLookups)
+	ch.adaptedLookups, ch.adaptedMisses = lookups, misses
+
+	partitioning := ch.blockPartitioning
+	switch {
+	case rate > highMissRate && partitioning < maxBlockOccupancy/2:
+		partitioning <<= 1
+	case rate < lowMissRate && partitioning > minBlockOccupancy:
+		partitioning >>= 1
+	default:
+		return false
+	}
+	ch.logf("consistenthash: adapting block partitioning from %d to %d for miss rate %.3f", ch.blockPartitioning, partitioning, rate)
+	ch.blockPartitioning = partitioning
+	return true
+}
@@ -0,0 +1,71 @@
+package consistenthash
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAdaptiveBlocks(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithBlockPartitioning(1)}, {WithBlockPartitioning(1000)}} {
+		hash := New(append(opts, WithAdaptiveBlocks())...)
+		var added int
+		for total := 100; total <= 10000; total += total / 4 {
+			for ; added < total; added++ {
+				hash.Add([]byte(fmt.Sprintf("node-%d", added)))
+			}
+			for i := 0; i < adaptInterval; i++ {
+				hash.Get([]byte(fmt.Sprintf("key-%d-%d", total, i)))
+			}
+			if err := hash.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			hash.mu.RLock()
+			occupancy := float64(hash.totalKeys) / float64(hash.totalBlocks)
+			hash.mu.RUnlock()
+			if occupancy < minBlockOccupancy || occupancy > maxBlockOccupancy {
+				t.Fatalf("expected %d to %d keys per block with %d keys, got %.2f", minBlockOccupancy, maxBlockOccupancy, added, occupancy)
+			}
+		}
+
+		// removing keeps the occupancy as well
+		for i := 0; i < added-100; i++ {
+			hash.Remove([]byte(fmt.Sprintf("node-%d", i)))
+		}
+		hash.mu.RLock()
+		if occupancy := float64(hash.totalKeys) / float64(hash.totalBlocks); occupancy < minBlockOccupancy || occupancy > maxBlockOccupancy {
+			t.Errorf("expected %d to %d keys per block after removing, got %.2f", minBlockOccupancy, maxBlockOccupancy, occupancy)
+		}
+		hash.mu.RUnlock()
+	}
+}
+
+func TestAdaptPartitioning(t *testing.T) {
+	hash := New(WithAdaptiveBlocks())
+	for i := 0; i < 1000; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	if hash.blockPartitioning != minBlockOccupancy {
+		t.Fatalf("expected to start with %d keys per block, got %d", minBlockOccupancy, hash.blockPartitioning)
+	}
+
+	// every lookup missed the block of its hash
+	hash.lookups, hash.misses = adaptInterval, adaptInterval
+	hash.Add([]byte("one more"))
+	if hash.blockPartitioning != minBlockOccupancy*2 {
+		t.Errorf("expected bigger blocks for a high miss rate, got %d", hash.blockPartitioning)
+	}
+	hash.Add([]byte("not checked again before enough lookups"))
+	if hash.blockPartitioning != minBlockOccupancy*2 {
+		t.Errorf("expected no change without new lookups, got %d", hash.blockPartitioning)
+	}
+
+	// no lookups missed
+	hash.lookups += adaptInterval
+	hash.Add([]byte("and another"))
+	if hash.blockPartitioning != minBlockOccupancy {
+		t.Errorf("expected smaller blocks for a low miss rate, got %d", hash.blockPartitioning)
+	}
+	if err := hash.Validate(); err != nil {
+		t.Error(err)
+	}
+}
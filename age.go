@@ -0,0 +1,22 @@
+package consistenthash
+
+import (
+	"bytes"
+	"time"
+)
+
+// NodeAge returns how long the key has been in the ring, adding an existing key again keeps its age while
+// removing and adding it again starts a new one. It returns false if the key doesn't exist or WithNodeTimestamps is not used
+func (ch *ConsistentHash) NodeAge(key []byte) (time.Duration, bool) {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	originalHash, existing, ok := ch.identify(key)
+	if !ok || !bytes.Equal(existing, key) {
+		return 0, false
+	}
+	addedAt, ok := ch.addedAt[originalHash]
+	if !ok {
+		return 0, false
+	}
+	return time.Since(addedAt), true
+}
@@ -0,0 +1,51 @@
+package consistenthash
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNodeAge(t *testing.T) {
+	hash := New(WithNodeTimestamps())
+	hash.Add([]byte("Bill"))
+	time.Sleep(20 * time.Millisecond)
+	hash.Add([]byte("Bob"))
+
+	bill, ok := hash.NodeAge([]byte("Bill"))
+	if !ok || bill < 20*time.Millisecond {
+		t.Fatalf("expected the age of Bill to be at least 20ms, got %v, %v", bill, ok)
+	}
+	if bob, ok := hash.NodeAge([]byte("Bob")); !ok || bob >= bill {
+		t.Errorf("expected Bob to be younger than %v, got %v, %v", bill, bob, ok)
+	}
+	if _, ok := hash.NodeAge([]byte("Alice")); ok {
+		t.Errorf("expected no age for a missing key")
+	}
+
+	// adding again keeps the age, removing and adding again starts a new one
+	hash.AddReplicas(5, []byte("Bill"))
+	if age, _ := hash.NodeAge([]byte("Bill")); age < bill {
+		t.Errorf("expected adding again to keep the age of %v, got %v", bill, age)
+	}
+	hash.Remove([]byte("Bill"))
+	if _, ok := hash.NodeAge([]byte("Bill")); ok {
+		t.Errorf("expected no age for a removed key")
+	}
+	hash.Add([]byte("Bill"))
+	if age, ok := hash.NodeAge([]byte("Bill")); !ok || age >= bill {
+		t.Errorf("expected a new age after adding Bill again, got %v, %v", age, ok)
+	}
+
+	// the ages are kept when the keys are moved to new positions
+	bob, _ := hash.NodeAge([]byte("Bob"))
+	hash.RehashAll(murmur32)
+	if age, ok := hash.NodeAge([]byte("Bob")); !ok || age < bob {
+		t.Errorf("expected Bob to keep the age of %v, got %v, %v", bob, age, ok)
+	}
+
+	hash = New()
+	hash.Add([]byte("Bill"))
+	if _, ok := hash.NodeAge([]byte("Bill")); ok {
+		t.Errorf("expected no age without timestamps")
+	}
+}
@@ -0,0 +1,95 @@
+package consistenthash
+
+import "bytes"
+
+// ArcShare returns the share of the circle owned by the key, the total length of its arcs divided by the size of the circle
+// it's kept up to date with WithArcCoverage, otherwise all the positions are visited. It returns 0 if the key doesn't exist
+func (ch *ConsistentHash) ArcShare(key []byte) float64 {
+	hash, ok := ch.hashSafely(key)
+	if !ok {
+		return 0
+	}
+
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	originalHash, existing, ok := ch.identifyHash(hash, key)
+	if !ok || !bytes.Equal(existing, key) {
+		return 0
+	}
+	return ch.shareOf(originalHash)
+}
+
+// ownedArcs returns the total length of the arcs owned by each original hash, the read lock must be held
+// the map is kept by the ring with WithArcCoverage, so it must not be changed
+func (ch *ConsistentHash) ownedArcs() map[uint32]uint64 {
+	if ch.arcCoverage != nil {
+		return ch.arcCoverage
+	}
+	return ch.computeArcs()
+}
+
+// computeArcs returns the total length of the arcs owned by each original hash visiting all the positions,
+// the read lock must be held
+func (ch *ConsistentHash) computeArcs() map[uint32]uint64 {
+	owned := make(map[uint32]uint64, len(ch.hashMap))
+	if ch.totalKeys == 0 {
+		return owned
+	}
+	if ch.totalKeys == 1 {
+		owned[ch.blocks[ch.firstBlock()][0].pointer] = ch.ringSize
+		return owned
+	}
+	// each position owns the arc after the previous position, the first one owns the arc after the last one
+	previous := ch.previous(ch.firstBlock(), 0).key
+	for blockNumber := uint32(0); blockNumber < ch.totalBlocks; blockNumber++ {
+		for _, n := range ch.blocks[blockNumber] {
+			owned[n.pointer] += arcOf(previous, n.key, ch.ringSize)
+			previous = n.key
+		}
+	}
+	return owned
+}
+
+// coverAdded moves the arc between the previous position and the added one from the item of the next position
+// to the item of the added position, the write lock must be held
+func (ch *ConsistentHash) coverAdded(blockNumber uint32, idx int) {
+	added := ch.blocks[blockNumber][idx]
+	if ch.totalKeys == 1 {
+		ch.arcCoverage[added.pointer] = ch.ringSize
+		return
+	}
+	arc := arcOf(ch.previous(blockNumber, idx).key, added.key, ch.ringSize)
+	ch.arcCoverage[ch.following(blockNumber, idx).pointer] -= arc
+	ch.arcCoverage[added.pointer] += arc
+}
+
+// coverRemoved moves the arc between the previous position and the removed one from the item of the removed position
+// to the item of the next position, the position must still be in its block and the write lock must be held
+func (ch *ConsistentHash) coverRemoved(blockNumber uint32, idx int) {
+	removed := ch.blocks[blockNumber][idx]
+	if ch.totalKeys > 1 {
+		arc := arcOf(ch.previous(blockNumber, idx).key, removed.key, ch.ringSize)
+		ch.arcCoverage[ch.following(blockNumber, idx).pointer] += arc
+		ch.arcCoverage[removed.pointer] -= arc
+	}
+	if ch.totalKeys == 1 || ch.arcCoverage[removed.pointer] == 0 {
+		// the last position of the item
+		delete(ch.arcCoverage, removed.pointer)
+	}
+}
+
+// following returns the next position clockwise after the given one, the first position of the circle after the last one
+func (ch *ConsistentHash) following(blockNumber uint32, idx int) node {
+	if idx+1 < len(ch.blocks[blockNumber]) {
+		return ch.blocks[blockNumber][idx+1]
+	}
+	// the first key of the next non-empty block, ends up in the same block if it's the only one
+	for i := uint32(1); i <= ch.totalBlocks; i++ {
+		nodes := ch.blocks[(blockNumber+i)%ch.totalBlocks]
+		if len(nodes) > 0 {
+			return nodes[0]
+		}
+	}
+	return ch.blocks[blockNumber][idx]
+}
@@ -0,0 +1,73 @@
+package consistenthash
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestArcCoverage(t *testing.T) {
+	for _, opts := range [][]Option{
+		{WithArcCoverage()},
+		{WithArcCoverage(), WithArrayTable(), WithBlockPartitioning(1)},
+		{WithArcCoverage(), WithRingSize(1 << 12), WithCollisionChaining()},
+		{WithArcCoverage(), WithMaxVirtualNodes(500), WithLazyRebuild(4)},
+	} {
+		hash := New(append(opts, WithDefaultReplicas(5))...)
+		rnd := rand.New(rand.NewSource(1))
+		for i := 0; i < 2000; i++ {
+			key := []byte(fmt.Sprintf("node-%d", rnd.Intn(50)))
+			switch rnd.Intn(4) {
+			case 0:
+				hash.Add(key)
+			case 1:
+				hash.AddReplicas(uint(rnd.Intn(20)+1), key)
+			case 2:
+				hash.Remove(key)
+			case 3:
+				hash.Reweight(map[string]uint{string(key): uint(rnd.Intn(10) + 1)})
+			}
+			if i%100 == 0 {
+				hash.Rehash(key)
+			}
+			if i%500 == 0 {
+				hash.RehashAll(hash.hashFunc.Load().(HashFunc))
+			}
+			assertArcCoverage(t, hash)
+		}
+
+		var total float64
+		for _, key := range hash.hashMap {
+			total += hash.ArcShare(key)
+		}
+		if len(hash.hashMap) > 0 && (total < 0.999999 || total > 1.000001) {
+			t.Errorf("expected the shares to add up to 1, got %f", total)
+		}
+		for i := 0; i < 50; i++ {
+			hash.Remove([]byte(fmt.Sprintf("node-%d", i)))
+		}
+		if len(hash.arcCoverage) != 0 {
+			t.Errorf("expected no coverage in an empty ring, got %v", hash.arcCoverage)
+		}
+	}
+
+	if share := New().ArcShare([]byte("missing")); share != 0 {
+		t.Errorf("expected no share for a missing key, got %f", share)
+	}
+}
+
+// assertArcCoverage checks the incrementally kept coverage against visiting all the positions
+func assertArcCoverage(t *testing.T, hash *ConsistentHash) {
+	t.Helper()
+	hash.mu.RLock()
+	defer hash.mu.RUnlock()
+	expected := hash.computeArcs()
+	if len(expected) != len(hash.arcCoverage) {
+		t.Fatalf("expected coverage of %d items, got %d", len(expected), len(hash.arcCoverage))
+	}
+	for pointer, owned := range expected {
+		if hash.arcCoverage[pointer] != owned {
+			t.Fatalf("expected coverage %d of %q, got %d", owned, hash.hashMap[pointer], hash.arcCoverage[pointer])
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package consistenthash
+
+// GetSortedBatch finds the closest item of each key like Get, the keys must be sorted by their HashKey,
+// so the lookups move forward through the circle instead of searching all the blocks for each key.
+// A key with a smaller hash than the previous key is looked up again, so unsorted keys are still routed
+// correctly, only slower. The items are returned in the order of the keys, nil for empty keys
+func (ch *ConsistentHash) GetSortedBatch(sortedKeys [][]byte) [][]byte {
+	items := make([][]byte, len(sortedKeys))
+	// hashed before locking, so a recovered panic is logged without holding the lock
+	hashes := make([]uint32, len(sortedKeys))
+	hashed := make([]bool, len(sortedKeys))
+	for i, key := range sortedKeys {
+		if !ch.allowEmptyKeys && len(key) == 0 {
+			continue
+		}
+		hashes[i], hashed[i] = ch.hashSafely(key)
+	}
+
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	if ch.totalKeys == 0 {
+		return items
+	}
+
+	var blockNumber, previous uint32
+	var idx int
+	positioned := false
+	for i, hash := range hashes {
+		if !hashed[i] {
+			continue
+		}
+		if ch.pins != nil {
+			if v, ok := ch.pinned(hash); ok {
+				items[i] = v
+				continue
+			}
+		}
+		if ch.multiProbe > 1 || ch.verifiedBlocks {
+			// the closest key is not the next one in the circle
+			items[i] = ch.get(hash)
+			continue
+		}
+		if ch.values == nil {
+			if v, ok := ch.hashMap[hash]; ok {
+				items[i] = v
+				continue
+			}
+		}
+
+		if !positioned || hash < previous {
+			blockNumber, idx, _ = ch.lookup(hash)
+			positioned = true
+		} else {
+			blockNumber, idx = ch.advance(blockNumber, idx, previous, hash)
+		}
+		previous = hash
+		items[i] = ch.valueOf(blockNumber, idx)
+	}
+	return items
+}
+
+// advance moves the closest key to the previous hash forward to the closest key to the hash, skipping whole blocks
+// when their last key is smaller than the hash, the read lock must be held
+func (ch *ConsistentHash) advance(blockNumber uint32, idx int, previous, hash uint32) (uint32, int) {
+	current := ch.blocks[blockNumber][idx].key
+	if current >= hash || current < previous {
+		// the key is still the closest, or all the keys are smaller than the previous hash, so the first key is the closest
+		return blockNumber, idx
+	}
+	for ; blockNumber < ch.totalBlocks; blockNumber++ {
+		nodes := ch.blocks[blockNumber]
+		if len(nodes) == 0 || nodes[len(nodes)-1].key < hash {
+			idx = 0
+			continue
+		}
+		return blockNumber, idx + ch.search(nodes[idx:], hash)
+	}
+	// the hash is bigger than all the keys, so the first key in the circle is the answer
+	return ch.firstBlock(), 0
+}
@@ -0,0 +1,74 @@
+package consistenthash
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestGetSortedBatch(t *testing.T) {
+	for _, opts := range [][]Option{
+		{WithDefaultReplicas(10)},
+		{WithDefaultReplicas(10), WithArrayTable(), WithBlockPartitioning(4)},
+		{WithMultiProbe(4)},
+	} {
+		hash := New(opts...)
+		for i := 0; i < 50; i++ {
+			hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+		}
+		keys := make([][]byte, 0, 2000)
+		for i := 0; i < 2000; i++ {
+			keys = append(keys, []byte(fmt.Sprintf("key-%d", i)))
+		}
+		// the items themselves and an empty key
+		keys = append(keys, []byte("node-7"), nil)
+
+		check := func(keys [][]byte) {
+			t.Helper()
+			items := hash.GetSortedBatch(keys)
+			for i, key := range keys {
+				if expected := hash.Get(key); !bytes.Equal(items[i], expected) {
+					t.Fatalf("expected %q for %q, got %q", expected, key, items[i])
+				}
+			}
+		}
+		// unsorted keys are routed correctly too
+		check(keys)
+		sort.Slice(keys, func(i, j int) bool {
+			return hash.HashKey(keys[i]) < hash.HashKey(keys[j])
+		})
+		check(keys)
+	}
+
+	if items := New().GetSortedBatch([][]byte{[]byte("key")}); len(items) != 1 || items[0] != nil {
+		t.Errorf("expected a nil item from an empty ring, got %q", items)
+	}
+}
+
+func BenchmarkGetSortedBatch(b *testing.B) {
+	hash := New(WithDefaultReplicas(100))
+	for i := 0; i < 100; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	keys := make([][]byte, 100000)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key-%d", i))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return hash.HashKey(keys[i]) < hash.HashKey(keys[j])
+	})
+
+	b.Run("Get", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, key := range keys {
+				hash.Get(key)
+			}
+		}
+	})
+	b.Run("GetSortedBatch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			hash.GetSortedBatch(keys)
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package consistenthash
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+// cachedResult result of Get for a hot key in a generation of the ring
+type cachedResult struct {
+	generation uint64
+	value      []byte
+}
+
+// cached returns the cached result of the hash if it's from the current generation, otherwise computes and caches it
+// the read lock must be held, concurrent readers might compute the same result at once
+func (ch *ConsistentHash) cached(entry *atomic.Value, hash uint32) []byte {
+	if result, ok := entry.Load().(cachedResult); ok && result.generation == ch.generation {
+		return result.value
+	}
+	value := ch.get(hash)
+	entry.Store(cachedResult{generation: ch.generation, value: value})
+	return value
+}
+
+// cacheKeys makes the result cache for the keys (WithResultCache)
+func (ch *ConsistentHash) cacheKeys(keys [][]byte) {
+	if len(keys) == 0 {
+		return
+	}
+	ch.cache = make(map[uint32]*atomic.Value, len(keys))
+	for _, key := range keys {
+		ch.cache[ch.hash(key)] = new(atomic.Value)
+	}
+}
+
+// nKey key of a cached GetN result
+type nKey struct {
+	hash uint32
+	n    int
+}
+
+// nResult result of GetN in a generation of the ring
+type nResult struct {
+	key        nKey
+	generation uint64
+	items      [][]byte
+}
+
+// nCache least recently used results of GetN, it has its own lock as it's changed by readers of the ring
+type nCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[nKey]*list.Element
+	order   *list.List // most recently used first
+}
+
+func newNCache(size int) *nCache {
+	return &nCache{size: size, entries: make(map[nKey]*list.Element, size), order: list.New()}
+}
+
+// get returns the cached items if they are from the given generation, results of other generations are dropped
+func (c *nCache) get(key nKey, generation uint64) ([][]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	result := e.Value.(*nResult)
+	if result.generation != generation {
+		c.order.Remove(e)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return result.items, true
+}
+
+// put caches the items, removing the least recently used result if the cache is full
+func (c *nCache) put(key nKey, generation uint64, items [][]byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		e.Value = &nResult{key: key, generation: generation, items: items}
+		c.order.MoveToFront(e)
+		return
+	}
+	if c.order.Len() >= c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*nResult).key)
+	}
+	c.entries[key] = c.order.PushFront(&nResult{key: key, generation: generation, items: items})
+}
+
+// cachedN returns the cached result of GetN for the hash if it's from the current generation, otherwise computes
+// and caches it, the read lock must be held. The cached items are copied, so the result can be changed by the caller
+func (ch *ConsistentHash) cachedN(hash uint32, n int) [][]byte {
+	key := nKey{hash, n}
+	items, ok := ch.nCache.get(key, ch.generation)
+	if !ok {
+		items = ch.getN(hash, n)
+		ch.nCache.put(key, ch.generation, items)
+	}
+	return append(make([][]byte, 0, len(items)), items...)
+}
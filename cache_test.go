@@ -0,0 +1,115 @@
+package consistenthash
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestResultCache(t *testing.T) {
+	hot := [][]byte{[]byte("hot-1"), []byte("hot-2"), []byte("hot-3")}
+	hash := New(WithDefaultReplicas(20), WithResultCache(hot))
+	expected := New(WithDefaultReplicas(20))
+	if v := hash.Get(hot[0]); v != nil {
+		t.Errorf("expected nil from empty ring, got %s", v)
+	}
+
+	for i := 0; i < 20; i++ {
+		node := []byte(fmt.Sprintf("node-%d", i))
+		hash.Add(node)
+		expected.Add(node)
+		for _, key := range hot {
+			// the second Get is served from the cache
+			for j := 0; j < 2; j++ {
+				if v := hash.GetString(string(key)); v != expected.GetString(string(key)) {
+					t.Fatalf("Asking for %s with %d items, should have yielded %s, got %s", key, i+1, expected.GetString(string(key)), v)
+				}
+			}
+		}
+	}
+	for i := 0; i < 19; i++ {
+		node := []byte(fmt.Sprintf("node-%d", i))
+		hash.Remove(node)
+		expected.Remove(node)
+		for _, key := range hot {
+			if v := hash.GetString(string(key)); v != expected.GetString(string(key)) {
+				t.Fatalf("Asking for %s after removing %s, should have yielded %s, got %s", key, node, expected.GetString(string(key)), v)
+			}
+		}
+	}
+}
+
+func TestGetNCache(t *testing.T) {
+	hash := New(WithDefaultReplicas(20), WithGetNCache(2))
+	expected := New(WithDefaultReplicas(20))
+	keys := [][]byte{[]byte("key-1"), []byte("key-2"), []byte("key-3")}
+	for i := 0; i < 10; i++ {
+		node := []byte(fmt.Sprintf("node-%d", i))
+		hash.Add(node)
+		expected.Add(node)
+		// more keys than the cache size, so the results are evicted as well
+		for j := 0; j < 3; j++ {
+			for _, key := range keys {
+				if items, want := hash.GetN(key, 3), expected.GetN(key, 3); !reflect.DeepEqual(items, want) {
+					t.Fatalf("expected %q for %s with %d items, got %q", want, key, i+1, items)
+				}
+			}
+		}
+	}
+
+	// changing the returned items doesn't change the cached result
+	items := hash.GetN(keys[0], 3)
+	items[0] = nil
+	if items := hash.GetN(keys[0], 3); items[0] == nil {
+		t.Errorf("expected the cached result not to be changed by the caller")
+	}
+
+	hash.Remove(items[1])
+	expected.Remove(items[1])
+	if items, want := hash.GetN(keys[0], 3), expected.GetN(keys[0], 3); !reflect.DeepEqual(items, want) {
+		t.Errorf("expected %q after removing an item, got %q", want, items)
+	}
+	if hash.nCache.order.Len() > 2 {
+		t.Errorf("expected at most 2 cached results, got %d", hash.nCache.order.Len())
+	}
+}
+
+func BenchmarkGetNHot(b *testing.B)       { benchmarkGetNHot(b, false) }
+func BenchmarkGetNHotCached(b *testing.B) { benchmarkGetNHot(b, true) }
+
+func benchmarkGetNHot(b *testing.B, cached bool) {
+	opts := []Option{WithDefaultReplicas(100), WithBlockPartitioning(50)}
+	if cached {
+		opts = append(opts, WithGetNCache(16))
+	}
+	hash := New(opts...)
+	for i := 0; i < 1000; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	hot := [][]byte{[]byte("hot-1"), []byte("hot-2"), []byte("hot-3"), []byte("hot-4")}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hash.GetN(hot[i&3], 5)
+	}
+}
+
+func BenchmarkGetHot(b *testing.B)       { benchmarkGetHot(b, false) }
+func BenchmarkGetHotCached(b *testing.B) { benchmarkGetHot(b, true) }
+
+func benchmarkGetHot(b *testing.B, cached bool) {
+	hot := [][]byte{[]byte("hot-1"), []byte("hot-2"), []byte("hot-3"), []byte("hot-4")}
+	opts := []Option{WithDefaultReplicas(100), WithBlockPartitioning(50)}
+	if cached {
+		opts = append(opts, WithResultCache(hot))
+	}
+	hash := New(opts...)
+	for i := 0; i < 1000; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hash.Get(hot[i&3])
+	}
+}
@@ -0,0 +1,216 @@
+package consistenthash
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// GetForAttempt finds the attempt-th distinct item clockwise from the key, attempt 0 is the same as Get
+// and the next attempts skip its item. When attempt exceeds the number of items it wraps around and starts from
+// the closest item again
+func (ch *ConsistentHash) GetForAttempt(key []byte, attempt int) []byte {
+	if attempt < 0 || (!ch.allowEmptyKeys && len(key) == 0) {
+		return nil
+	}
+
+	hash, ok := ch.hashSafely(key)
+	if !ok {
+		return nil
+	}
+
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	if len(ch.hashMap) == 0 {
+		return nil
+	}
+
+	// routed like Get, so pinned keys and the exact match are the first attempt
+	first := ch.route(hash)
+	attempt %= len(ch.hashMap)
+	if attempt == 0 {
+		return first
+	}
+	var item []byte
+	pointers := make([]uint32, 0, attempt)
+	ch.walk(ch.probe(hash), func(blockNumber uint32, idx int) bool {
+		pointer := ch.blocks[blockNumber][idx].pointer
+		if containsPointer(pointers, pointer) {
+			return true
+		}
+		value := ch.valueOf(blockNumber, idx)
+		if bytes.Equal(value, first) {
+			return true
+		}
+		pointers = append(pointers, pointer)
+		if len(pointers) == attempt {
+			item = value
+			return false
+		}
+		return true
+	})
+	return item
+}
+
+// GetCandidates returns up to max distinct items clockwise from the key, closest first
+// it stops as soon as it collects max items or visits all the items, and allocates at most
+// for the number of items available in the ring, so a large max is safe to use
+func (ch *ConsistentHash) GetCandidates(key []byte, max int) [][]byte {
+	return ch.GetN(key, max)
+}
+
+// GetNWithCount is the same as GetN, but also reports whether n distinct items were available
+// when it's false the result contains all the items in the ring, which are less than n
+func (ch *ConsistentHash) GetNWithCount(key []byte, n int) ([][]byte, bool) {
+	items := ch.GetN(key, n)
+	return items, len(items) == n
+}
+
+// Quorum returns the majority of the replication factor, floor(rf/2)+1 distinct items clockwise from the key
+// it returns an error if the ring has fewer items than the majority
+func (ch *ConsistentHash) Quorum(key []byte, replicationFactor int) ([][]byte, error) {
+	if replicationFactor < 1 {
+		return nil, fmt.Errorf("consistenthash: invalid replication factor %d", replicationFactor)
+	}
+	majority := replicationFactor/2 + 1
+	items := ch.GetN(key, majority)
+	if len(items) < majority {
+		return nil, fmt.Errorf("consistenthash: quorum of %d needs %d items, found %d", replicationFactor, majority, len(items))
+	}
+	return items, nil
+}
+
+// StickyGet returns the item equal to last if it's still one of the two closest items to the key, otherwise the same as Get
+// it keeps routing to the previous item while a new item takes over the key, until the previous item is removed
+func (ch *ConsistentHash) StickyGet(key []byte, last []byte) []byte {
+	items := ch.GetN(key, 2)
+	if len(items) == 0 {
+		return nil
+	}
+	if last != nil {
+		for _, item := range items {
+			if bytes.Equal(item, last) {
+				return item
+			}
+		}
+	}
+	return items[0]
+}
+
+// GetOther finds the closest item to the key which is not the key itself, walking clockwise past the key's own positions
+// it returns nil if the key is the only item, useful to pick a peer other than the node itself
+func (ch *ConsistentHash) GetOther(key []byte) []byte {
+	if !ch.allowEmptyKeys && len(key) == 0 {
+		return nil
+	}
+
+	hash, ok := ch.hashSafely(key)
+	if !ok {
+		return nil
+	}
+
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	var other []byte
+	ch.walk(ch.probe(hash), func(blockNumber uint32, idx int) bool {
+		item := ch.valueOf(blockNumber, idx)
+		if bytes.Equal(item, key) {
+			return true
+		}
+		other = item
+		return false
+	})
+	return other
+}
+
+// GetNFiltered finds the n closest distinct items to the key walking clockwise, skipping the key itself
+// and the items exclude returns true for, exclude is called once per item while holding the read lock, so it must not use the ring
+func (ch *ConsistentHash) GetNFiltered(key []byte, n int, exclude func(item []byte) bool) [][]byte {
+	if n < 1 || (!ch.allowEmptyKeys && len(key) == 0) {
+		return nil
+	}
+
+	hash, ok := ch.hashSafely(key)
+	if !ok {
+		return nil
+	}
+
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	if ch.totalKeys == 0 {
+		return nil
+	}
+	var items [][]byte
+	visited := make([]uint32, 0, n)
+	ch.walk(ch.probe(hash), func(blockNumber uint32, idx int) bool {
+		pointer := ch.blocks[blockNumber][idx].pointer
+		if containsPointer(visited, pointer) {
+			return true
+		}
+		visited = append(visited, pointer)
+		item := ch.valueOf(blockNumber, idx)
+		if bytes.Equal(item, key) || (exclude != nil && exclude(item)) {
+			return true
+		}
+		items = append(items, item)
+		return len(items) < n
+	})
+	return items
+}
+
+// Neighbors returns the closest items counter-clockwise and clockwise of the key's own position in the ring,
+// other positions of the key's replicas are skipped, so both are different from the key
+// it returns nil for both if the key is not in the ring or it's the only item
+func (ch *ConsistentHash) Neighbors(key []byte) (predecessor, successor []byte) {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	originalHash, existing, ok := ch.identify(key)
+	if !ok || !bytes.Equal(existing, key) || len(ch.hashMap) < 2 {
+		return nil, nil
+	}
+	ch.walk(originalHash, func(blockNumber uint32, idx int) bool {
+		if ch.blocks[blockNumber][idx].pointer == originalHash {
+			return true
+		}
+		successor = ch.valueOf(blockNumber, idx)
+		return false
+	})
+	ch.walkBack(originalHash, func(blockNumber uint32, idx int) bool {
+		if ch.blocks[blockNumber][idx].pointer == originalHash {
+			return true
+		}
+		predecessor = ch.valueOf(blockNumber, idx)
+		return false
+	})
+	return predecessor, successor
+}
+
+// ReplicaList returns up to n distinct items in a fixed order for replicated storage, primary first
+// the order is defined by the positions only: starting from the first position not less than the hash of the key,
+// positions are visited in ascending order wrapping around the end of the circle, keeping the first position of each item.
+// Rings with the same positions return the same list, multi-probe, pins and the blocks of the ring aren't used
+func (ch *ConsistentHash) ReplicaList(key []byte, n int) [][]byte {
+	if n < 1 || (!ch.allowEmptyKeys && len(key) == 0) {
+		return nil
+	}
+
+	hash, ok := ch.hashSafely(key)
+	if !ok {
+		return nil
+	}
+
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	if n > len(ch.hashMap) {
+		n = len(ch.hashMap)
+	}
+	if n == 0 {
+		return nil
+	}
+	items := make([][]byte, n)
+	return items[:ch.fillFrom(items, hash)]
+}
@@ -0,0 +1,303 @@
+package consistenthash
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestGetForAttempt(t *testing.T) {
+	hash := New(WithDefaultReplicas(20), WithBlockPartitioning(5))
+	hash.Add([]byte("Bill"), []byte("Bob"), []byte("Bonny"), []byte("Becky"))
+
+	for i := 0; i < 50; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		items := hash.GetN(key, 4)
+		for attempt := 0; attempt < 8; attempt++ {
+			item := hash.GetForAttempt(key, attempt)
+			if !bytes.Equal(item, items[attempt%4]) {
+				t.Errorf("attempt %d for %s should have yielded %s, got %s", attempt, key, items[attempt%4], item)
+			}
+		}
+		if !bytes.Equal(hash.GetForAttempt(key, 0), hash.Get(key)) {
+			t.Errorf("attempt 0 for %s should be the same as Get", key)
+		}
+	}
+
+	// a pinned key is routed like Get on the first attempt, and to the other items afterwards
+	key := []byte("key-1")
+	pinned := hash.GetN(key, 4)[3]
+	hash.Pin(key, pinned)
+	seen := make(map[string]bool)
+	for attempt := 0; attempt < 4; attempt++ {
+		seen[string(hash.GetForAttempt(key, attempt))] = true
+	}
+	if item := hash.GetForAttempt(key, 0); !bytes.Equal(item, pinned) || len(seen) != 4 {
+		t.Errorf("expected the pinned item %s first and all 4 items over the attempts, got %s and %v", pinned, item, seen)
+	}
+}
+
+func TestGetCandidates(t *testing.T) {
+	hash := New(WithDefaultReplicas(20))
+	hash.Add([]byte("Bill"), []byte("Bob"), []byte("Bonny"))
+
+	items := hash.GetCandidates([]byte("Ben"), 1000)
+	if len(items) != 3 || cap(items) != 3 {
+		t.Errorf("expected 3 items with capacity 3, got %d with capacity %d", len(items), cap(items))
+	}
+	if items = hash.GetCandidates([]byte("Ben"), 2); len(items) != 2 || !bytes.Equal(items[0], hash.Get([]byte("Ben"))) {
+		t.Errorf("expected the 2 closest items, got %q", items)
+	}
+	if items = New().GetCandidates([]byte("Ben"), 2); items != nil {
+		t.Errorf("expected no items in an empty ring, got %q", items)
+	}
+}
+
+func TestGetNWithCount(t *testing.T) {
+	hash := New(WithDefaultReplicas(10))
+	hash.Add([]byte("Bill"), []byte("Bob"))
+
+	items, ok := hash.GetNWithCount([]byte("Ben"), 3)
+	if ok || len(items) != 2 {
+		t.Errorf("expected false with 2 items, got %v with %d items", ok, len(items))
+	}
+	if items, ok = hash.GetNWithCount([]byte("Ben"), 2); !ok || len(items) != 2 {
+		t.Errorf("expected true with 2 items, got %v with %d items", ok, len(items))
+	}
+}
+
+func TestQuorum(t *testing.T) {
+	hash := New(WithDefaultReplicas(10))
+	if _, err := hash.Quorum([]byte("Ben"), 3); err == nil {
+		t.Errorf("expected an error for an empty ring")
+	}
+	hash.Add([]byte("Bill"), []byte("Bob"), []byte("Bonny"))
+
+	items, err := hash.Quorum([]byte("Ben"), 3)
+	if err != nil || len(items) != 2 || bytes.Equal(items[0], items[1]) {
+		t.Fatalf("expected 2 distinct items, got %q, %v", items, err)
+	}
+	if !bytes.Equal(items[0], hash.Get([]byte("Ben"))) {
+		t.Errorf("expected the closest item first, got %s", items[0])
+	}
+	if items, err = hash.Quorum([]byte("Ben"), 4); err != nil || len(items) != 3 {
+		t.Errorf("expected 3 items for rf 4, got %q, %v", items, err)
+	}
+	if _, err = hash.Quorum([]byte("Ben"), 6); err == nil {
+		t.Errorf("expected an error for 4 items out of 3")
+	}
+	if _, err = hash.Quorum([]byte("Ben"), 0); err == nil {
+		t.Errorf("expected an error for rf 0")
+	}
+}
+
+func TestStickyGet(t *testing.T) {
+	hash := New(WithDefaultReplicas(20))
+	hash.Add([]byte("Bill"), []byte("Bob"), []byte("Bonny"))
+
+	last := make(map[string][]byte)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		last[key] = hash.StickyGet([]byte(key), nil)
+		if !bytes.Equal(last[key], hash.Get([]byte(key))) {
+			t.Fatalf("expected StickyGet without last to be the same as Get for %s", key)
+		}
+	}
+
+	hash.Add([]byte("Becky"))
+	var moved int
+	for key, item := range last {
+		if !bytes.Equal(hash.Get([]byte(key)), item) {
+			moved++
+		}
+		if v := hash.StickyGet([]byte(key), item); !bytes.Equal(v, item) {
+			t.Errorf("expected %s to stick to %s after adding an item, got %s", key, item, v)
+		}
+	}
+	if moved == 0 {
+		t.Fatalf("expected some keys to move to the new item")
+	}
+
+	hash.Remove([]byte("Bob"))
+	for key, item := range last {
+		v := hash.StickyGet([]byte(key), item)
+		if string(item) == "Bob" && !bytes.Equal(v, hash.Get([]byte(key))) {
+			t.Errorf("expected %s to be released from the removed item, got %s", key, v)
+		}
+	}
+}
+
+func TestGetOther(t *testing.T) {
+	hash := New(WithDefaultReplicas(20))
+	if v := hash.GetOther([]byte("Bill")); v != nil {
+		t.Errorf("expected nil from empty ring, got %s", v)
+	}
+	hash.Add([]byte("Bill"))
+	if v := hash.GetOther([]byte("Bill")); v != nil {
+		t.Errorf("expected nil when the key is the only item, got %s", v)
+	}
+	if v := hash.GetOther([]byte("Ben")); string(v) != "Bill" {
+		t.Errorf("expected Bill for another key, got %s", v)
+	}
+
+	hash.Add([]byte("Bob"), []byte("Bonny"))
+	for _, node := range []string{"Bill", "Bob", "Bonny"} {
+		if hash.GetString(node) != node {
+			t.Fatalf("expected %s to be its own closest item", node)
+		}
+		v := hash.GetOther([]byte(node))
+		if v == nil || string(v) == node {
+			t.Errorf("expected a peer other than %s, got %q", node, v)
+		}
+		if items := hash.GetN([]byte(node), 2); !bytes.Equal(v, items[1]) {
+			t.Errorf("expected the next item %s after %s, got %s", items[1], node, v)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		if !bytes.Equal(hash.GetOther(key), hash.Get(key)) {
+			t.Errorf("expected the same item as Get for %s", key)
+		}
+	}
+
+	// the same neighbour as GetN with multi-probe
+	probed := New(WithMultiProbe(8))
+	probed.Add([]byte("Bill"), []byte("Bob"), []byte("Bonny"), []byte("Becky"))
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		if v, items := probed.GetOther(key), probed.GetN(key, 1); !bytes.Equal(v, items[0]) {
+			t.Errorf("expected %s for %s with multi-probe, got %s", items[0], key, v)
+		}
+	}
+}
+
+func TestGetNFiltered(t *testing.T) {
+	hash := New(WithDefaultReplicas(20))
+	var nodes []string
+	for i := 0; i < 10; i++ {
+		nodes = append(nodes, fmt.Sprintf("node-%d", i))
+		hash.Add([]byte(nodes[i]))
+	}
+	// every other node is excluded
+	odd := func(item []byte) bool {
+		i, _ := strconv.Atoi(strings.TrimPrefix(string(item), "node-"))
+		return i%2 == 1
+	}
+
+	for _, key := range append(nodes, "key-1", "key-2", "key-3") {
+		items := hash.GetNFiltered([]byte(key), 3, odd)
+		var expected [][]byte
+		for _, item := range hash.GetN([]byte(key), 10) {
+			if string(item) != key && !odd(item) && len(expected) < 3 {
+				expected = append(expected, item)
+			}
+		}
+		if !reflect.DeepEqual(items, expected) {
+			t.Errorf("expected %q for %s, got %q", expected, key, items)
+		}
+	}
+
+	// fewer items are left than asked for
+	if items := hash.GetNFiltered([]byte("node-0"), 10, odd); len(items) != 4 {
+		t.Errorf("expected the 4 other even nodes, got %q", items)
+	}
+	if items := hash.GetNFiltered([]byte("key"), 2, nil); !reflect.DeepEqual(items, hash.GetN([]byte("key"), 2)) {
+		t.Errorf("expected the same as GetN without a filter, got %q", items)
+	}
+}
+
+func TestNeighbors(t *testing.T) {
+	// keys are their own hash, so the positions are known
+	hash := New(WithBlockPartitioning(1), WithHashFunc(identityHash))
+	hash.Add([]byte("100"))
+	if p, s := hash.Neighbors([]byte("100")); p != nil || s != nil {
+		t.Errorf("expected no neighbors for the only item, got %s and %s", p, s)
+	}
+	hash.Add([]byte("2000000000"), []byte("3000000000"), []byte("4000000000"))
+
+	testCases := map[string][2]string{
+		"100":        {"4000000000", "2000000000"},
+		"2000000000": {"100", "3000000000"},
+		"3000000000": {"2000000000", "4000000000"},
+		"4000000000": {"3000000000", "100"},
+	}
+	for key, expected := range testCases {
+		p, s := hash.Neighbors([]byte(key))
+		if string(p) != expected[0] || string(s) != expected[1] {
+			t.Errorf("expected neighbors of %s to be %s and %s, got %s and %s", key, expected[0], expected[1], p, s)
+		}
+	}
+	if p, s := hash.Neighbors([]byte("5")); p != nil || s != nil {
+		t.Errorf("expected no neighbors for a missing key, got %s and %s", p, s)
+	}
+
+	// replicas of the key itself are skipped
+	hash = New(WithDefaultReplicas(50))
+	hash.Add([]byte("Bill"), []byte("Bob"))
+	if p, s := hash.Neighbors([]byte("Bill")); string(p) != "Bob" || string(s) != "Bob" {
+		t.Errorf("expected Bob on both sides of Bill, got %s and %s", p, s)
+	}
+}
+
+func TestReplicaList(t *testing.T) {
+	members := make([][]byte, 50)
+	for i := range members {
+		members[i] = []byte(fmt.Sprintf("node-%d", i))
+	}
+
+	// built independently, with different internals and insertion order
+	client := New(WithDefaultReplicas(20), WithBlockPartitioning(2))
+	client.Add(members...)
+	other := New(WithDefaultReplicas(20), WithBlockPartitioning(16), WithArrayTable(), WithGallopingSearch())
+	for i := len(members) - 1; i >= 0; i-- {
+		other.Add(members[i])
+	}
+
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		list := client.ReplicaList(key, 3)
+		if otherList := other.ReplicaList(key, 3); !reflect.DeepEqual(list, otherList) {
+			t.Fatalf("expected the same replica list for %q, got %q and %q", key, list, otherList)
+		}
+		if expected := replicaListOf(client, members, 20, key, 3); !reflect.DeepEqual(list, expected) {
+			t.Fatalf("expected %q for %q, got %q", expected, key, list)
+		}
+	}
+
+	if list := client.ReplicaList([]byte("key"), 100); len(list) != len(members) {
+		t.Errorf("expected all %d members, got %d", len(members), len(list))
+	}
+	if list := client.ReplicaList([]byte("key"), 0); list != nil {
+		t.Errorf("expected nil for no replicas, got %q", list)
+	}
+}
+
+// replicaListOf follows the documented order of ReplicaList on the sorted positions of the members
+func replicaListOf(ch *ConsistentHash, members [][]byte, replicas uint, key []byte, n int) [][]byte {
+	var nodes []node
+	for _, member := range members {
+		nodes = ch.appendNodes(nodes, member, replicas)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].key < nodes[j].key })
+	items := make(map[uint32][]byte, len(members))
+	for _, member := range members {
+		items[ch.hash(member)] = member
+	}
+
+	hash := ch.hash(key)
+	start := sort.Search(len(nodes), func(i int) bool { return nodes[i].key >= hash })
+	var list [][]byte
+	seen := make(map[uint32]bool)
+	for i := 0; i < len(nodes) && len(list) < n; i++ {
+		pointer := nodes[(start+i)%len(nodes)].pointer
+		if !seen[pointer] {
+			seen[pointer] = true
+			list = append(list, items[pointer])
+		}
+	}
+	return list
+}
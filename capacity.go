@@ -0,0 +1,49 @@
+package consistenthash
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrCapacityExceeded is returned by TryAdd when the keys are not added as they exceed the capacity (WithCapacity)
+var ErrCapacityExceeded = errors.New("consistenthash: capacity exceeded")
+
+// fits checks the given number of new virtual nodes can be added within the capacity or the callback allows it,
+// the write lock must be held
+func (ch *ConsistentHash) fits(nodes int) bool {
+	if ch.capacity == 0 {
+		return true
+	}
+	attempted := int(ch.totalKeys) + nodes
+	if attempted <= ch.capacity {
+		return true
+	}
+	if ch.onCapacity != nil && ch.onCapacity(attempted) {
+		return true
+	}
+	ch.logf("consistenthash: adding %d virtual nodes exceeds the capacity of %d", nodes, ch.capacity)
+	return false
+}
+
+// growth returns the number of virtual nodes added by adding the key with the given number of replicas,
+// only the extra replicas are counted for a key which already exists, the lock must be held
+func (ch *ConsistentHash) growth(hash uint32, key []byte, replicas uint) int {
+	originalHash, existing, ok := ch.identifyHash(hash, key)
+	if !ok || !bytes.Equal(existing, key) {
+		return int(replicas)
+	}
+	if previous := ch.replicasOf(originalHash); previous < replicas {
+		return int(replicas - previous)
+	}
+	return 0
+}
+
+// keysGrowth returns the growth of the keys with the same number of replicas, nodes must contain
+// "replicas" number of nodes for each key in the same order as keys, the lock must be held
+func (ch *ConsistentHash) keysGrowth(keys [][]byte, nodes []node, replicas uint) int {
+	var total int
+	for idx := range keys {
+		total += ch.growth(nodes[uint(idx)*replicas].key, keys[idx], replicas)
+	}
+	return total
+}
@@ -0,0 +1,101 @@
+package consistenthash
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCapacity(t *testing.T) {
+	hash := New(WithDefaultReplicas(10), WithCapacity(25))
+	if err := hash.TryAdd([]byte("Bill"), []byte("Bob")); err != nil {
+		t.Fatal(err)
+	}
+	fingerprint := hash.Fingerprint()
+
+	if err := hash.TryAdd([]byte("Bonny")); !errors.Is(err, ErrCapacityExceeded) {
+		t.Errorf("expected the capacity to be exceeded, got %v", err)
+	}
+	hash.Add([]byte("Bonny"))
+	hash.AddReplicas(6, []byte("Ben"))
+	hash.AddWeighted([]WeightedKey{{Key: []byte("Ben"), Replicas: 6}})
+	if hash.Fingerprint() != fingerprint {
+		t.Errorf("expected the ring not to change when the capacity is exceeded")
+	}
+	hash.AddReplicas(5, []byte("Ben"))
+	if hash.GetString("Ben") != "Ben" {
+		t.Errorf("expected to add within the capacity")
+	}
+
+	// the callback decides
+	var attempts []int
+	allow := false
+	hash = New(WithDefaultReplicas(10), WithCapacity(20), WithOnCapacityExceeded(func(attemptedTotal int) bool {
+		attempts = append(attempts, attemptedTotal)
+		return allow
+	}))
+	hash.Add([]byte("Bill"), []byte("Bob"))
+	if err := hash.TryAdd([]byte("Bonny")); err == nil || len(attempts) != 1 || attempts[0] != 30 {
+		t.Errorf("expected the callback to reject 30 virtual nodes, got %v %v", err, attempts)
+	}
+	allow = true
+	if err := hash.TryAdd([]byte("Bonny")); err != nil || hash.GetString("Bonny") != "Bonny" {
+		t.Errorf("expected the callback to allow exceeding the capacity, got %v", err)
+	}
+}
+
+func TestCapacityOnEveryAddPath(t *testing.T) {
+	full := func() *ConsistentHash {
+		hash := New(WithDefaultReplicas(10), WithCapacity(20))
+		hash.Add([]byte("Bill"), []byte("Bob"))
+		return hash
+	}
+	other := New(WithDefaultReplicas(10))
+	other.Add([]byte("Bonny"), []byte("Ben"))
+	var config bytes.Buffer
+	if err := other.WriteConfig(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, grow := range map[string]func(hash *ConsistentHash){
+		"AddTiered": func(hash *ConsistentHash) { hash.AddTiered(1, 10, []byte("Bonny")) },
+		"Reweight":  func(hash *ConsistentHash) { hash.Reweight(map[string]uint{"Bill": 300}) },
+		"Merge":     func(hash *ConsistentHash) { hash.Merge(other) },
+		"ReadConfig": func(hash *ConsistentHash) {
+			hash.Add([]byte("Bonny"), []byte("Ben"), []byte("Bert"))
+			config.WriteString("\"Bert\" 100\n")
+			if err := hash.ReadConfig(bytes.NewReader(config.Bytes())); !errors.Is(err, ErrCapacityExceeded) {
+				t.Errorf("expected the capacity to be exceeded, got %v", err)
+			}
+		},
+	} {
+		hash := full()
+		grow(hash)
+		if positions, _ := hash.Snapshot(); len(positions) > 20 {
+			t.Errorf("%s: expected at most 20 positions, got %d", name, len(positions))
+		}
+	}
+
+	// the items have a single replica, so equalizing can only add replicas
+	hash := New(WithDefaultReplicas(1), WithCapacity(3))
+	hash.Add([]byte("Bill"), []byte("Bob"), []byte("Bonny"))
+	hash.EqualizeArcs(10)
+	if positions, _ := hash.Snapshot(); len(positions) > 3 {
+		t.Errorf("EqualizeArcs: expected at most 3 positions, got %d", len(positions))
+	}
+
+	hash = full()
+	if copied := NewFromSnapshot(other.SnapshotView(), WithCapacity(10)); !copied.IsEmpty() {
+		t.Errorf("expected an empty ring for a view exceeding the capacity")
+	}
+
+	// adding the existing keys again doesn't add positions
+	if err := hash.TryAdd([]byte("Bill"), []byte("Bob")); err != nil {
+		t.Errorf("expected to add the existing keys again at the capacity, got %v", err)
+	}
+	hash.AddWeighted([]WeightedKey{{Key: []byte("Bob"), Replicas: 10}})
+	hash.AddTiered(1, 10, []byte("Bob"))
+	if _, standbys := hash.GetTiered([]byte("key")); len(standbys) != 1 || string(standbys[0]) != "Bob" {
+		t.Errorf("expected Bob to be moved to tier 1 at the capacity, got %q", standbys)
+	}
+}
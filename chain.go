@@ -0,0 +1,113 @@
+package consistenthash
+
+import "bytes"
+
+// chainKey finds the hash to store the key by when its hash is taken by another key, the write lock must be held
+// the smaller key keeps the hash, so a bigger key which is already stored by the hash is moved to a secondary hash
+func (ch *ConsistentHash) chainKey(originalHash uint32, key, existing []byte) uint32 {
+	for _, chained := range ch.chains[originalHash] {
+		if bytes.Equal(ch.hashMap[chained], key) {
+			// already chained
+			return chained
+		}
+	}
+	if ch.hash(existing) == originalHash && bytes.Compare(key, existing) < 0 {
+		if slot, ok := ch.chainSlot(existing); ok {
+			ch.moveKey(originalHash, slot, existing)
+		} else {
+			ch.logf("consistenthash: no free hash to chain %q by, the circle is full", existing)
+		}
+		return originalHash
+	}
+	chained, ok := ch.chainSlot(key)
+	if !ok {
+		ch.logf("consistenthash: no free hash to chain %q by, the circle is full", key)
+		return originalHash
+	}
+	ch.chains[originalHash] = append(ch.chains[originalHash], chained)
+	ch.logf("consistenthash: hash %d of %q collides with %q, chaining it by %d", originalHash, key, existing, chained)
+	return chained
+}
+
+// chainSlot returns a free hash to store a colliding key by, starting from the hash of the reversed key
+// the probe may cycle in a small circle (WithRingSize), so after ring size steps the free hash is scanned for,
+// returns false if the circle is full
+func (ch *ConsistentHash) chainSlot(key []byte) (uint32, bool) {
+	if uint64(len(ch.hashMap)) >= ch.ringSize {
+		return 0, false
+	}
+	slot := ch.hash(reverse(key))
+	for i := uint64(0); i < ch.ringSize; i++ {
+		if _, ok := ch.hashMap[slot]; !ok {
+			return slot, true
+		}
+		slot = ch.fold(fmix32(slot + probeStep))
+	}
+	for i := uint64(0); i < ch.ringSize; i++ {
+		if _, ok := ch.hashMap[slot]; !ok {
+			return slot, true
+		}
+		slot = ch.fold(slot + 1)
+	}
+	return 0, false
+}
+
+// reverse returns a copy of the key with its bytes reversed
+func reverse(key []byte) []byte {
+	reversed := make([]byte, len(key))
+	for i := range key {
+		reversed[len(key)-1-i] = key[i]
+	}
+	return reversed
+}
+
+// moveKey moves the stored key with its replicas to another hash and chains it, the write lock must be held
+func (ch *ConsistentHash) moveKey(from, to uint32, key []byte) {
+	replicas := ch.replicasOf(from)
+	salt, salted := ch.salts[from]
+	for _, n := range ch.appendSalted(make([]node, 0, nodesCap(1, replicas)), from, key, replicas, salt) {
+		ch.remove(n.key, n.pointer)
+	}
+	ch.logf("consistenthash: hash %d of %q is taken by a smaller key, chaining it by %d", from, key, to)
+
+	delete(ch.hashMap, from)
+	ch.hashMap[to] = key
+	if r, found := ch.replicaMap[from]; found {
+		delete(ch.replicaMap, from)
+		ch.replicaMap[to] = r
+	}
+	if salted {
+		delete(ch.salts, from)
+		ch.salts[to] = salt
+	}
+	if tier, found := ch.tiers[from]; found {
+		delete(ch.tiers, from)
+		ch.tiers[to] = tier
+	}
+	if addedAt, found := ch.addedAt[from]; found {
+		delete(ch.addedAt, from)
+		ch.addedAt[to] = addedAt
+	}
+	ch.chains[from] = append(ch.chains[from], to)
+	ch.addNodes(ch.appendSalted(make([]node, 0, nodesCap(1, replicas)), to, key, replicas, salt))
+}
+
+// unchain removes the hash of a chained key from the chain of its own hash, the write lock must be held
+func (ch *ConsistentHash) unchain(originalHash uint32, key []byte) {
+	if ch.chains == nil {
+		return
+	}
+	hash := ch.hash(key)
+	chain := ch.chains[hash]
+	for i, chained := range chain {
+		if chained == originalHash {
+			chain = append(chain[:i], chain[i+1:]...)
+			break
+		}
+	}
+	if len(chain) == 0 {
+		delete(ch.chains, hash)
+		return
+	}
+	ch.chains[hash] = chain
+}
@@ -0,0 +1,105 @@
+package consistenthash
+
+import (
+	"fmt"
+	"hash/crc32"
+	"testing"
+)
+
+func TestCollisionChaining(t *testing.T) {
+	// Bob, Ben and Bill have the same hash
+	collide := func(key []byte) uint32 {
+		switch string(key) {
+		case "Bob", "Ben":
+			key = []byte("Bill")
+		}
+		return crc32.ChecksumIEEE(key)
+	}
+
+	hash := New(WithHashFunc(collide), WithCollisionChaining(), WithDefaultReplicas(10))
+	hash.Add([]byte("Bob"), []byte("Bill"), []byte("Bonny"))
+	hash.AddReplicas(20, []byte("Ben"))
+	if err := hash.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		found[hash.GetString(fmt.Sprintf("key-%d", i))] = true
+	}
+	for _, key := range []string{"Bob", "Ben", "Bill", "Bonny"} {
+		if !found[key] {
+			t.Errorf("expected %s to be reachable, got %v", key, found)
+		}
+	}
+	// the smallest key keeps the hash
+	if item := hash.GetString("Bob"); item != "Ben" {
+		t.Errorf("expected the smallest colliding key on the shared hash, got %s", item)
+	}
+
+	// the order of adding doesn't matter
+	other := New(WithHashFunc(collide), WithCollisionChaining(), WithDefaultReplicas(10))
+	other.AddReplicas(20, []byte("Ben"))
+	other.Add([]byte("Bonny"), []byte("Bill"), []byte("Bob"))
+	if hash.Fingerprint() != other.Fingerprint() {
+		t.Errorf("expected the same ring regardless of the order")
+	}
+
+	// adding again doesn't make another chain
+	hash.Add([]byte("Bob"))
+	hash.Rehash([]byte("Bob"))
+	if err := hash.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if hash.Remove([]byte("Bert")) {
+		t.Errorf("expected a missing key not to be removed")
+	}
+	if !hash.Remove([]byte("Bob")) || !hash.Remove([]byte("Ben")) {
+		t.Fatalf("expected the chained keys to be removed")
+	}
+	if err := hash.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		if item := hash.GetString(fmt.Sprintf("key-%d", i)); item != "Bill" && item != "Bonny" {
+			t.Fatalf("expected only the remaining keys, got %s", item)
+		}
+	}
+	// Bill stays chained after Ben, the key with the hash, is removed
+	if chain := hash.chains[collide([]byte("Bill"))]; len(hash.chains) != 1 || len(chain) != 1 || string(hash.hashMap[chain[0]]) != "Bill" {
+		t.Errorf("expected only Bill to be chained, got %v", hash.chains)
+	}
+
+	// without chaining the colliding key replaces the first one
+	replacing := New(WithHashFunc(collide))
+	replacing.Add([]byte("Bill"), []byte("Bob"))
+	if item := replacing.GetString("key"); item != "Bob" {
+		t.Errorf("expected the colliding key to replace the first one, got %s", item)
+	}
+}
+
+func TestCollisionChainingSmallCircle(t *testing.T) {
+	// the probe cycles through taken hashes in a small circle
+	for _, size := range []uint64{8, 32} {
+		var logged int
+		hash := New(WithRingSize(size), WithCollisionChaining(), WithDefaultReplicas(2), WithLogger(func(string, ...any) {
+			logged++
+		}))
+		for i := 0; i < 20; i++ {
+			hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+		}
+		if err := hash.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		// every free hash is used before the colliding keys replace the others
+		expected := 20
+		if size < 20 {
+			expected = int(size)
+		}
+		if len(hash.hashMap) != expected {
+			t.Errorf("expected %d keys in a circle of %d, got %d", expected, size, len(hash.hashMap))
+		}
+		if size < 20 && logged == 0 {
+			t.Errorf("expected the replaced keys to be logged")
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package consistenthash
+
+import "bytes"
+
+// ChurnReport the movement of the sample keys between two views of a ring, reported by CompareSnapshots
+type ChurnReport struct {
+	Sampled int     // number of sample keys
+	Moved   int     // number of sample keys routed to another item
+	Churn   float64 // fraction of the sample keys routed to another item
+	// ShareDelta change of the fraction of the sample keys routed to each item, positive for items gaining keys,
+	// items of both views are included even without any change
+	ShareDelta map[string]float64
+}
+
+// CompareSnapshots routes the sample keys with both views and reports how many of them moved to another item
+// and how the share of the keys changed for each item, so the impact of a change can be measured after the fact
+func CompareSnapshots(before, after *RingView, sampleKeys [][]byte) ChurnReport {
+	report := ChurnReport{Sampled: len(sampleKeys), ShareDelta: make(map[string]float64)}
+	for _, view := range []*RingView{before, after} {
+		for _, item := range view.items {
+			report.ShareDelta[string(item)] = 0
+		}
+	}
+	if len(sampleKeys) == 0 {
+		return report
+	}
+
+	share := 1 / float64(len(sampleKeys))
+	for _, key := range sampleKeys {
+		from, to := before.Get(key), after.Get(key)
+		if from != nil {
+			report.ShareDelta[string(from)] -= share
+		}
+		if to != nil {
+			report.ShareDelta[string(to)] += share
+		}
+		if !bytes.Equal(from, to) || (from == nil) != (to == nil) {
+			report.Moved++
+		}
+	}
+	report.Churn = float64(report.Moved) / float64(report.Sampled)
+	return report
+}
@@ -0,0 +1,54 @@
+package consistenthash
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestCompareSnapshots(t *testing.T) {
+	hash := New(WithDefaultReplicas(100), WithMurmur32())
+	for i := 0; i < 4; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	before := hash.SnapshotView()
+	hash.Add([]byte("node-4"))
+	after := hash.SnapshotView()
+
+	keys := make([][]byte, 10000)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key-%d", i))
+	}
+	report := CompareSnapshots(before, after, keys)
+
+	// only the keys taken by the new node move, about 1/5 of them
+	var moved int
+	for _, key := range keys {
+		if string(after.Get(key)) == "node-4" {
+			moved++
+		}
+	}
+	if report.Sampled != len(keys) || report.Moved != moved {
+		t.Errorf("expected %d of %d keys to move, got %d of %d", moved, len(keys), report.Moved, report.Sampled)
+	}
+	if report.Churn < 0.15 || report.Churn > 0.25 {
+		t.Errorf("expected about 0.2 of the keys to move, got %f", report.Churn)
+	}
+	if delta := report.ShareDelta["node-4"]; math.Abs(delta-report.Churn) > 1e-9 {
+		t.Errorf("expected node-4 to gain the moved share %f, got %f", report.Churn, delta)
+	}
+	var total float64
+	for item, delta := range report.ShareDelta {
+		if item != "node-4" && delta > 0 {
+			t.Errorf("expected %s not to gain keys, got %f", item, delta)
+		}
+		total += delta
+	}
+	if len(report.ShareDelta) != 5 || math.Abs(total) > 1e-9 {
+		t.Errorf("expected the share of 5 items to be moved between them, got %v", report.ShareDelta)
+	}
+
+	if report := CompareSnapshots(after, after, keys); report.Moved != 0 || report.Churn != 0 {
+		t.Errorf("expected no churn between the same views, got %+v", report)
+	}
+}
@@ -0,0 +1,127 @@
+package consistenthash
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WriteConfig writes the keys and their number of replicas as lines of quoted key and replicas, sorted by the keys
+// the same keys and replicas always make the same output, so it can be reviewed and diffed, ReadConfig reads it back
+func (ch *ConsistentHash) WriteConfig(w io.Writer) error {
+	ch.mu.RLock()
+	entries := make([]WeightedKey, 0, len(ch.hashMap))
+	for originalHash, key := range ch.hashMap {
+		entries = append(entries, WeightedKey{Key: key, Replicas: ch.replicasOf(originalHash)})
+	}
+	ch.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].Key, entries[j].Key) < 0
+	})
+	bw := bufio.NewWriter(w)
+	for _, entry := range entries {
+		if _, err := fmt.Fprintf(bw, "%q %d\n", entry.Key, entry.Replicas); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadConfig replaces the keys in the ring with the keys written by WriteConfig, empty lines and lines starting with # are skipped
+// the ring is not changed if the config is invalid, has a key more than once or the keys exceed the capacity (WithCapacity)
+func (ch *ConsistentHash) ReadConfig(r io.Reader) error {
+	var entries []WeightedKey
+	seen := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		entry, err := parseConfigLine(text)
+		if err != nil {
+			return fmt.Errorf("consistenthash: line %d: %w", line, err)
+		}
+		if !ch.allowEmptyKeys && len(entry.Key) == 0 {
+			continue
+		}
+		if first, ok := seen[string(entry.Key)]; ok {
+			return fmt.Errorf("consistenthash: line %d: key %q is already on line %d", line, entry.Key, first)
+		}
+		seen[string(entry.Key)] = line
+		entry.Replicas = ch.clampReplicas(entry.Replicas)
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	// hashed before locking, so a panicking hash function leaves the ring as it was
+	hashes := make([]uint32, len(entries))
+	for i, entry := range entries {
+		var ok bool
+		if hashes[i], ok = ch.hashSafely(entry.Key); ok && ch.chains != nil {
+			// the secondary hash of a colliding key
+			_, ok = ch.hashSafely(reverse(entry.Key))
+		}
+		if !ok {
+			return fmt.Errorf("consistenthash: key %q can't be hashed", entry.Key)
+		}
+	}
+
+	ch.lock()
+	defer ch.unlock()
+	// the keys replace all the positions of the ring
+	total := 0
+	for _, entry := range entries {
+		total += int(entry.Replicas)
+	}
+	if !ch.fits(total - int(ch.totalKeys)) {
+		return ErrCapacityExceeded
+	}
+	keep := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		keep[string(entry.Key)] = true
+	}
+	for originalHash, key := range ch.hashMap {
+		if !keep[string(key)] {
+			ch.emit(EventRemoved, key)
+			delete(ch.hashMap, originalHash)
+			delete(ch.replicaMap, originalHash)
+			delete(ch.salts, originalHash)
+			delete(ch.tiers, originalHash)
+			delete(ch.addedAt, originalHash)
+			if ch.loads != nil {
+				ch.loads.Delete(string(key))
+			}
+			ch.unchain(originalHash, key)
+		}
+	}
+	for i, entry := range entries {
+		ch.storeKey(hashes[i], entry.Key, entry.Replicas)
+	}
+	ch.rebuild()
+	ch.scaleReplicas()
+	return nil
+}
+
+// parseConfigLine parses a line of quoted key and number of replicas
+func parseConfigLine(text string) (WeightedKey, error) {
+	quoted, err := strconv.QuotedPrefix(text)
+	if err != nil {
+		return WeightedKey{}, fmt.Errorf("invalid key: %w", err)
+	}
+	key, err := strconv.Unquote(quoted)
+	if err != nil {
+		return WeightedKey{}, fmt.Errorf("invalid key: %w", err)
+	}
+	replicas, err := strconv.ParseUint(strings.TrimSpace(text[len(quoted):]), 10, 0)
+	if err != nil || replicas < 1 {
+		return WeightedKey{}, fmt.Errorf("invalid replicas %q", strings.TrimSpace(text[len(quoted):]))
+	}
+	return WeightedKey{Key: []byte(key), Replicas: uint(replicas)}, nil
+}
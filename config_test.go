@@ -0,0 +1,90 @@
+package consistenthash
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestConfig(t *testing.T) {
+	hash := New(WithDefaultReplicas(10))
+	hash.Add([]byte("Bill"), []byte("Bob"), []byte("with space"), []byte("new\nline"))
+	hash.AddReplicas(20, []byte("Bonny"))
+
+	var config bytes.Buffer
+	if err := hash.WriteConfig(&config); err != nil {
+		t.Fatal(err)
+	}
+	expected := "\"Bill\" 10\n\"Bob\" 10\n\"Bonny\" 20\n\"new\\nline\" 10\n\"with space\" 10\n"
+	if config.String() != expected {
+		t.Fatalf("expected config %q, got %q", expected, config.String())
+	}
+
+	other := New(WithDefaultReplicas(10), WithEventBuffer(10, false))
+	other.Add([]byte("Bill"), []byte("Ben"))
+	if err := other.ReadConfig(strings.NewReader("# members\n\n" + config.String())); err != nil {
+		t.Fatal(err)
+	}
+	if hash.Fingerprint() != other.Fingerprint() {
+		t.Errorf("expected the same ring after reading the config")
+	}
+	if err := other.Validate(); err != nil {
+		t.Error(err)
+	}
+	var events []string
+	for len(other.Events()) > 0 {
+		event := <-other.Events()
+		events = append(events, fmt.Sprintf("%d %s", event.Type, event.Key))
+	}
+	// Bill and Ben are added first, then Ben is removed and the rest are added
+	if len(events) != 7 || events[2] != fmt.Sprintf("%d Ben", EventRemoved) {
+		t.Errorf("expected only Ben to be removed, got %q", events)
+	}
+
+	for _, invalid := range []string{"Bill 10", "\"Bill\"", "\"Bill\" 0", "\"Bill\" -1", "\"Bill 10", "\"Bill\" 10\n\"Bill\" 20"} {
+		if err := other.ReadConfig(strings.NewReader(invalid)); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+	if hash.Fingerprint() != other.Fingerprint() {
+		t.Errorf("expected the ring not to change by an invalid config")
+	}
+
+	// a key the hash function panics on doesn't change the ring
+	for _, opts := range [][]Option{nil, {WithRecoverHashPanics()}} {
+		panicking := New(append(opts, WithHashFunc(panickingHash))...)
+		panicking.Add([]byte("Bill"), []byte("Bob"))
+		fingerprint := panicking.Fingerprint()
+		func() {
+			defer func() { recover() }()
+			if err := panicking.ReadConfig(strings.NewReader("\"Bill\" 10\n\"bad-1\" 10")); err == nil {
+				t.Errorf("expected an error for a key the hash function panics on")
+			}
+		}()
+		if panicking.Fingerprint() != fingerprint {
+			t.Errorf("expected the ring not to change by a key the hash function panics on")
+		}
+		panicking.Add([]byte("Bonny"))
+	}
+}
+
+func TestConfigDeterministic(t *testing.T) {
+	keys := [][]byte{[]byte("c"), []byte("a"), []byte("b"), []byte("d")}
+	var first string
+	for i := 0; i < len(keys); i++ {
+		hash := New()
+		for j := range keys {
+			hash.Add(keys[(i+j)%len(keys)])
+		}
+		var config bytes.Buffer
+		if err := hash.WriteConfig(&config); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			first = config.String()
+		} else if config.String() != first {
+			t.Errorf("expected the same config regardless of the order, got %q and %q", first, config.String())
+		}
+	}
+}
@@ -3,15 +3,43 @@ package consistenthash
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
 	"hash/crc32"
+	"hash/fnv"
 	"math"
 	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+const (
+	// addChunkSize number of keys added at once by AddContext between checking the context
+	addChunkSize = 1024
+	// maxReplicas maximum number of replicas per key, the circle can't have more positions
+	maxReplicas = math.MaxUint32
+	// maxPreallocNodes maximum number of nodes to allocate in advance, more nodes grow the slice as needed
+	maxPreallocNodes = 1 << 20
+	// compositeSeparator separates the parts of composite keys (ASCII unit separator)
+	compositeSeparator = 0x1f
+	// probeStep golden ratio constant added to the hash for each probe before mixing, so the probes are unrelated
+	probeStep = 0x9e3779b9
 )
 
 // HashFunc hash function to generate random hash
 type HashFunc func(data []byte) uint32
 
+// Logger printf like function to write internal logs
+type Logger func(format string, args ...any)
+
+type logEntry struct {
+	format string
+	args   []any
+}
+
 type node struct {
 	key     uint32
 	pointer uint32
@@ -19,59 +47,249 @@ type node struct {
 
 // ConsistentHash everything we need for CH
 type ConsistentHash struct {
+	lookups           uint64 // number of block lookups by Get, accessed atomically and first to be 64bit aligned
+	misses            uint64 // number of block lookups by Get not found in the block of the hash, accessed atomically
+	inFlight          int64  // number of acquisitions by Acquire not released yet, accessed atomically
 	mu                sync.RWMutex
-	hash              HashFunc
+	readLocks         []readLock   // taken by Get instead of mu by the hash of the key (only WithShardedReadLocks)
+	hashFunc          atomic.Value // HashFunc of the ring, swapped by RehashAll
 	pool              sync.Pool
+	nodePool          sync.Pool         // buffers of the nodes of the added keys, reused by add
+	buffers           *sync.Pool        // buffers to hash the replicas, might be shared with other rings
 	replicas          uint              // default number of replicas in hash ring (higher number means more possibility for balance equality)
 	hashMap           map[uint32][]byte // Hash table key value pair (hash(x): x) * replicas (nodes)
 	replicaMap        map[uint32]uint   // Number of replicas per stored key
-	blockMap          map[uint32][]node // fixed size blocks in the circle each might contain a list of keys
+	blocks            [][]node          // fixed size blocks in the circle each might contain a list of keys, indexed by block number
+	values            [][][]byte        // values of the keys in each block aligned with blocks (only WithArrayTable)
 	totalBlocks       uint32
 	totalKeys         uint32
+	latencies         *latencyHistogram // durations of Get (only WithLatencyMetrics)
+	loadFactor        float64           // bound of the load of each item relative to the average load (only WithBoundedLoad)
+	loads             *sync.Map         // number of acquisitions not released yet by item (only WithBoundedLoad)
 	blockPartitioning uint32
+	ringSize          uint64 // number of positions in the circle, the hashes are folded into it (WithRingSize)
+	adaptiveBlocks    bool
+	adaptedLookups    uint64 // number of lookups when the block partitioning was last checked (only WithAdaptiveBlocks)
+	adaptedMisses     uint64 // number of misses when the block partitioning was last checked (only WithAdaptiveBlocks)
+	maxVirtualNodes   uint   // default number of replicas is scaled to keep total nodes around this number
+	allowEmptyKeys    bool
+	copyKeys          bool
+	externalValues    [][]byte // values added by AddByIndex, shared with the caller (only WithExternalValues)
+	gallopingSearch   bool
+	verifiedBlocks    bool
+	recoverHashPanics bool
+	keyNormalizer     func(string) string
+	pins              map[uint32]pin // pinned items by hash of the keys
+	replicaJitter     bool
+	nodeHasher        func(key []byte, index uint32) uint32 // hashes the replicas instead of the key with the index appended
+	jitterSeed        uint32
+	salts             map[uint32]uint32        // salts of the rehashed keys by their hash (only after Rehash)
+	chains            map[uint32][]uint32      // hashes of the colliding keys stored by other hashes, by their own hash (only WithCollisionChaining)
+	tiers             map[uint32]int           // tiers of the keys added by AddTiered by their hash, keys in tier 0 are not stored
+	addedAt           map[uint32]time.Time     // times the keys were added by their hash (only WithNodeTimestamps)
+	arcCoverage       map[uint32]uint64        // total length of the arcs owned by each hash (only WithArcCoverage)
+	multiProbe        int                      // number of hashes probed by Get to find the closest key (only WithMultiProbe)
+	maxProbeBlocks    uint32                   // number of blocks searched by lookup before jumping to the next occupied block
+	occupied          []uint64                 // bitmap of the blocks with at least one key (only WithMaxProbeBlocks)
+	cache             map[uint32]*atomic.Value // cached results of the hot keys by their hash (only WithResultCache)
+	nCache            *nCache                  // least recently used results of GetN (only WithGetNCache)
+	generation        uint64                   // changed after each write lock, to invalidate the cached results
+	lazyRebuild       uint32                   // number of removed keys before resizing the blocks
+	rebuildThreshold  float64                  // change of the number of keys relative to the last resize to resize the blocks again
+	removals          uint32                   // number of removed keys since the last resize (only WithLazyRebuild)
+	drains            sync.WaitGroup           // draining goroutines
+	closed            chan struct{}            // closed by Close to stop draining
+	closeOnce         sync.Once
+	capacity          int                           // maximum number of virtual nodes, 0 means no limit (only WithCapacity)
+	onCapacity        func(attemptedTotal int) bool // decides whether to exceed the capacity (only WithOnCapacityExceeded)
+	logger            Logger
+	logs              []logEntry // logs collected while holding the lock
+	events            chan RingEvent
+	blockOnEvents     bool        // sending events waits for a full channel instead of dropping them (WithEventBuffer)
+	pending           []RingEvent // events collected while holding the lock
+	historySize       int
+	history           []ChangeRecord // last changes of the items, oldest first from historyStart (only WithChangeHistory)
+	historyStart      int
+	muted             bool // changes are not reported while set, the write lock must be held
+	sharing           bool // keys are stored without copying while set (AddByIndex), the write lock must be held
 }
 
 // New makes new ConsistentHash
 func New(opts ...Option) *ConsistentHash {
-	var o options
+	o := options{copyKeys: true, eventBuffer: -1}
 	for _, opt := range opts {
 		opt(&o)
 	}
 	ch := &ConsistentHash{
-		replicas:   o.defaultReplicas,
-		hash:       o.hashFunc,
-		hashMap:    make(map[uint32][]byte, 0),
-		replicaMap: make(map[uint32]uint, 0),
+		replicas:        o.defaultReplicas,
+		logger:          o.logger,
+		allowEmptyKeys:  o.allowEmptyKeys,
+		copyKeys:        o.copyKeys,
+		gallopingSearch: o.gallopingSearch,
+		verifiedBlocks:  o.verifiedBlocks,
+		keyNormalizer:   o.keyNormalizer,
+		replicaJitter:   o.replicaJitter,
+		jitterSeed:      uint32(o.jitterSeed) ^ uint32(o.jitterSeed>>32),
+		multiProbe:      o.multiProbe,
+		hashMap:         make(map[uint32][]byte, 0),
+		replicaMap:      make(map[uint32]uint, 0),
+		closed:          make(chan struct{}),
+	}
+	ch.recoverHashPanics = o.recoverHashPanics
+	ch.nodeHasher = o.nodeHasher
+	ch.ringSize = ringSize
+	if o.ringSize > 1 && o.ringSize < ringSize {
+		ch.ringSize = o.ringSize
+	}
+	if o.externalValues != nil {
+		// the items added by AddByIndex share the memory of the values
+		ch.externalValues = o.externalValues
+	}
+	if o.readLocks > 1 {
+		ch.readLocks = make([]readLock, o.readLocks)
+	}
+	if o.getNCache > 0 {
+		ch.nCache = newNCache(o.getNCache)
+	}
+	if o.latencyMetrics {
+		ch.latencies = new(latencyHistogram)
+	}
+	if o.loadFactor > 0 {
+		ch.loadFactor = math.Max(o.loadFactor, 1)
+		ch.loads = new(sync.Map)
 	}
 
 	if ch.replicas < 1 {
 		ch.replicas = 1
 	}
+	ch.replicas = ch.clampReplicas(ch.replicas)
+
+	hash := o.hashFunc
+	if hash == nil {
+		hash = crc32.ChecksumIEEE
+	}
 
-	if ch.hash == nil {
-		ch.hash = crc32.ChecksumIEEE
+	if o.shared != nil {
+		hash = o.shared.hash
+		ch.buffers = &o.shared.buffers
+	} else {
+		ch.buffers = &sync.Pool{New: func() any { return new(bytes.Buffer) }}
 	}
+	ch.hashFunc.Store(hash)
 
 	if o.blockPartitioning < 1 {
 		o.blockPartitioning = 1
 	}
+	if o.withoutBlocks {
+		// no number of keys makes a second block
+		o.blockPartitioning = math.MaxUint32
+		o.adaptiveBlocks = false
+	}
+	if o.adaptiveBlocks {
+		ch.adaptiveBlocks = true
+		if o.blockPartitioning < minBlockOccupancy {
+			o.blockPartitioning = minBlockOccupancy
+		} else if o.blockPartitioning > maxBlockOccupancy/2 {
+			o.blockPartitioning = maxBlockOccupancy / 2
+		}
+	}
 
 	ch.blockPartitioning = uint32(o.blockPartitioning)
-	ch.blockMap = make(map[uint32][]node, ch.blockPartitioning)
-	ch.pool = sync.Pool{New: func() any { return make(map[uint32][]node, o.blockPartitioning) }}
+	ch.blocks = make([][]node, 1)
+	ch.pool = sync.Pool{New: func() any { return new([][]node) }}
+	ch.nodePool = sync.Pool{New: func() any { return new([]node) }}
 	ch.totalBlocks = 1
 
+	if o.maxVirtualNodes > 0 {
+		ch.maxVirtualNodes = uint(o.maxVirtualNodes)
+	}
+
+	if o.lazyRebuild > 0 {
+		ch.lazyRebuild = uint32(o.lazyRebuild)
+	}
+
+	if o.capacity > 0 {
+		ch.capacity = o.capacity
+		ch.onCapacity = o.capacityCallback
+	}
+
+	if o.rebuildThreshold > 0 {
+		ch.rebuildThreshold = o.rebuildThreshold
+	}
+
+	if o.maxProbeBlocks > 0 {
+		ch.maxProbeBlocks = uint32(o.maxProbeBlocks)
+		ch.occupied = make([]uint64, 1)
+	}
+
+	if o.collisionChaining {
+		ch.chains = make(map[uint32][]uint32)
+	}
+
+	if o.nodeTimestamps {
+		ch.addedAt = make(map[uint32]time.Time)
+	}
+
+	if o.arcCoverage {
+		ch.arcCoverage = make(map[uint32]uint64)
+	}
+
+	if o.eventBuffer >= 0 {
+		ch.events = make(chan RingEvent, o.eventBuffer)
+		ch.blockOnEvents = o.blockOnEvents
+	}
+
+	if o.changeHistory > 0 {
+		ch.historySize = o.changeHistory
+		ch.history = make([]ChangeRecord, 0, o.changeHistory)
+	}
+
+	ch.cacheKeys(o.cachedKeys)
+
+	if o.arrayTable {
+		ch.values = make([][][]byte, 1)
+	}
+
+	if len(o.members) > 0 {
+		members := make([][]byte, len(o.members))
+		copy(members, o.members)
+		sort.Slice(members, func(i, j int) bool {
+			return bytes.Compare(members[i], members[j]) < 0
+		})
+		ch.Add(members...)
+	}
+
 	return ch
 }
 
 // IsEmpty returns true if there are no items available
 func (ch *ConsistentHash) IsEmpty() bool {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
 	return ch.totalKeys == 0
 }
 
-// Add adds some keys to the hash
+// Add adds some keys to the hash, nothing is added if it exceeds the capacity (WithCapacity), use TryAdd to know it
 func (ch *ConsistentHash) Add(keys ...[]byte) {
-	ch.add(ch.replicas, keys...)
+	_ = ch.tryAdd(false, keys)
+}
+
+// TryAdd is the same as Add, but returns ErrCapacityExceeded if nothing is added as it exceeds the capacity,
+// and ErrEmptyKey or ErrHashPanicked instead of skipping a key, then none of the keys are added
+func (ch *ConsistentHash) TryAdd(keys ...[]byte) error {
+	if err := ch.checkKeys(keys); err != nil {
+		return err
+	}
+	return ch.tryAdd(false, keys)
+}
+
+// tryAdd adds the keys with the default number of replicas, the keys are stored without copying if share is set
+func (ch *ConsistentHash) tryAdd(share bool, keys [][]byte) error {
+	keys = ch.filterKeys(keys)
+	if ch.maxVirtualNodes > 0 {
+		return ch.addScaled(share, keys...)
+	}
+	return ch.add(ch.replicas, share, keys...)
 }
 
 // AddReplicas adds key and generates "replicas" number of hashes in ring
@@ -79,47 +297,360 @@ func (ch *ConsistentHash) AddReplicas(replicas uint, keys ...[]byte) {
 	if replicas < 1 {
 		return
 	}
-	ch.add(replicas, keys...)
+	_ = ch.add(ch.clampReplicas(replicas), false, ch.filterKeys(keys)...)
+}
+
+// WeightedKey a key with its number of replicas in hash ring
+type WeightedKey struct {
+	Key      []byte
+	Replicas uint
+}
+
+// AddWeighted adds keys with different number of replicas at once, entries with less than 1 replica are ignored
+func (ch *ConsistentHash) AddWeighted(entries []WeightedKey) {
+	var total int
+	replicas := make([]uint, len(entries))
+	for i := range entries {
+		if !ch.acceptKey(entries[i].Key) {
+			continue
+		}
+		replicas[i] = ch.clampReplicas(entries[i].Replicas)
+		total += nodesCap(1, replicas[i])
+		if total > maxPreallocNodes {
+			total = maxPreallocNodes
+		}
+	}
+	nodes := make([]node, 0, total)
+	for i := range entries {
+		if replicas[i] > 0 {
+			nodes = ch.appendNodes(nodes, entries[i].Key, replicas[i])
+		}
+	}
+
+	ch.lock()
+	defer ch.unlock()
+	var growth int
+	var offset uint
+	for i := range entries {
+		if replicas[i] > 0 {
+			growth += ch.growth(nodes[offset].key, entries[i].Key, replicas[i])
+			offset += replicas[i]
+		}
+	}
+	if !ch.fits(growth) {
+		return
+	}
+	offset = 0
+	for i := range entries {
+		if replicas[i] > 0 {
+			originalHash := ch.storeKey(nodes[offset].key, entries[i].Key, replicas[i])
+			ch.placeNodes(nodes[offset:offset+replicas[i]], originalHash, entries[i].Key)
+			offset += replicas[i]
+		}
+	}
+	ch.addNodes(ch.dropReplaced(nodes, len(entries), func(i int) ([]byte, uint) { return entries[i].Key, replicas[i] }))
+	ch.scaleReplicas()
+}
+
+// Reweight changes the number of replicas of the existing keys to the given weights and rebuilds the ring once
+// keys which are not in the weights keep their number of replicas, weights less than 1 and unknown keys are ignored
+// nothing is changed if the new replicas exceed the capacity (WithCapacity)
+func (ch *ConsistentHash) Reweight(weights map[string]uint) {
+	// clamped before locking, as clamping might call the logger
+	clamped := make(map[string]uint, len(weights))
+	for key, weight := range weights {
+		if weight >= 1 {
+			clamped[key] = ch.clampReplicas(weight)
+		}
+	}
+
+	ch.lock()
+	defer ch.unlock()
+	changes := make(map[uint32]uint)
+	var growth int
+	for key, weight := range clamped {
+		originalHash, existing, ok := ch.identify([]byte(key))
+		if !ok || string(existing) != key {
+			continue
+		}
+		if replicas := ch.replicasOf(originalHash); replicas != weight {
+			changes[originalHash] = weight
+			growth += int(weight) - int(replicas)
+		}
+	}
+	if len(changes) == 0 || !ch.fits(growth) {
+		return
+	}
+	for originalHash, weight := range changes {
+		ch.setReplicas(originalHash, weight)
+	}
+	ch.rebuild()
+}
+
+// AddContext adds keys to the hash in chunks, checking the context between chunks
+// returns the number of added keys and the context error if it's cancelled, the keys added so far remain in the ring
+func (ch *ConsistentHash) AddContext(ctx context.Context, keys ...[]byte) (int, error) {
+	var added int
+	for added < len(keys) {
+		if err := ctx.Err(); err != nil {
+			return added, err
+		}
+		end := added + addChunkSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		ch.Add(keys[added:end]...)
+		added = end
+	}
+	return added, nil
 }
 
 // Get finds the closest item in the hash ring to the provided key
+// the returned item shares the memory of the ring, so it must not be changed, use GetCopy to own it
 func (ch *ConsistentHash) Get(key []byte) []byte {
-	if ch.IsEmpty() {
+	if !ch.allowEmptyKeys && len(key) == 0 {
 		return nil
 	}
 
-	hash := ch.hash(key)
+	if ch.latencies != nil {
+		defer ch.latencies.since(time.Now())
+	}
+	hash, ok := ch.hashSafely(key)
+	if !ok {
+		return nil
+	}
+	return ch.GetByHashHint(hash)
+}
 
-	ch.mu.RLock()
-	defer ch.mu.RUnlock()
+// GetCopy is the same as Get, but returns a copy of the item which can be changed without affecting the ring
+func (ch *ConsistentHash) GetCopy(key []byte) []byte {
+	item := ch.Get(key)
+	if item == nil {
+		return nil
+	}
+	return append(make([]byte, 0, len(item)), item...)
+}
+
+// hash hashes the key with the current hash function of the ring
+func (ch *ConsistentHash) hash(key []byte) uint32 {
+	return ch.fold(ch.hashFunc.Load().(HashFunc)(key))
+}
+
+// HashKey returns the hash of the key used for routing, to be given to GetByHashHint and GetNByHashHint
+func (ch *ConsistentHash) HashKey(key []byte) uint32 {
+	return ch.hash(key)
+}
+
+// GetByHashHint is the same as Get with the hash of the key returned by HashKey
+// it avoids hashing the key again when routing the same key more than once
+func (ch *ConsistentHash) GetByHashHint(hash uint32) []byte {
+	defer ch.readLock(hash).RUnlock()
 
-	// check if the exact match exist in the hash table
-	if v, ok := ch.hashMap[hash]; ok {
-		return v
+	if ch.totalKeys == 0 {
+		return nil
 	}
 
-	v, _ := ch.lookup(hash)
-	return v
+	if ch.pins != nil {
+		if v, ok := ch.pinned(hash); ok {
+			return v
+		}
+	}
+
+	if ch.cache != nil {
+		if entry, ok := ch.cache[hash]; ok {
+			return ch.cached(entry, hash)
+		}
+	}
+	return ch.get(hash)
+}
+
+// GetExact is the same as Get and also reports whether the key is an item of the ring, not a key routed to the closest item
+func (ch *ConsistentHash) GetExact(key []byte) ([]byte, bool) {
+	if !ch.allowEmptyKeys && len(key) == 0 {
+		return nil, false
+	}
+
+	hash, ok := ch.hashSafely(key)
+	if !ok {
+		return nil, false
+	}
+
+	defer ch.readLock(hash).RUnlock()
+
+	if ch.totalKeys == 0 {
+		return nil, false
+	}
+	_, existing, exact := ch.identifyHash(hash, key)
+	return ch.route(hash), exact && bytes.Equal(existing, key)
+}
+
+// get finds the closest item in the hash ring to the hash, the read lock must be held
+func (ch *ConsistentHash) get(hash uint32) []byte {
+	hash = ch.probe(hash)
+
+	// check if the exact match exist in the hash table, the array table resolves it in lookup
+	if ch.values == nil {
+		if v, ok := ch.hashMap[hash]; ok {
+			return v
+		}
+	}
+
+	// the counters are shared by all the readers, so they are skipped with WithShardedReadLocks
+	counted := ch.readLocks == nil
+	if counted {
+		atomic.AddUint64(&ch.lookups, 1)
+	}
+	if blockNumber, idx, ok := ch.lookup(hash); ok {
+		if counted && blockNumber != ch.blockNumberOf(hash, ch.totalBlocks) {
+			atomic.AddUint64(&ch.misses, 1)
+		}
+		if ch.verifiedBlocks && !ch.verify(hash, blockNumber, idx) {
+			blockNumber, idx = ch.scan(hash)
+		}
+		return ch.valueOf(blockNumber, idx)
+	}
+	return nil
+}
+
+// MissRate returns the ratio of block lookups by Get which didn't find the item in the block of the hash
+// a high rate means blocks are often empty, so block partitioning needs a bigger number
+func (ch *ConsistentHash) MissRate() float64 {
+	lookups := atomic.LoadUint64(&ch.lookups)
+	if lookups == 0 {
+		return 0
+	}
+	return float64(atomic.LoadUint64(&ch.misses)) / float64(lookups)
+}
+
+// GetN finds the n closest distinct items in the hash ring to the provided key, walking clockwise
+// items with many replicas are returned only once, so the result has fewer than n items only if the ring has fewer items
+func (ch *ConsistentHash) GetN(key []byte, n int) [][]byte {
+	if n < 1 || (!ch.allowEmptyKeys && len(key) == 0) {
+		return nil
+	}
+
+	hash, ok := ch.hashSafely(key)
+	if !ok {
+		return nil
+	}
+	return ch.GetNByHashHint(hash, n)
+}
+
+// GetNByHashHint is the same as GetN with the hash of the key returned by HashKey
+func (ch *ConsistentHash) GetNByHashHint(hash uint32, n int) [][]byte {
+	if n < 1 {
+		return nil
+	}
+
+	defer ch.readLock(hash).RUnlock()
+
+	if ch.totalKeys == 0 {
+		return nil
+	}
+	if ch.nCache != nil {
+		return ch.cachedN(hash, n)
+	}
+	return ch.getN(hash, n)
+}
+
+// GetNInto fills dst with up to len(dst) closest distinct items to the key, walking clockwise, and returns the number of items
+// it doesn't allocate, so dst can be reused between calls
+func (ch *ConsistentHash) GetNInto(dst [][]byte, key []byte) int {
+	if len(dst) == 0 || (!ch.allowEmptyKeys && len(key) == 0) {
+		return 0
+	}
+
+	hash, ok := ch.hashSafely(key)
+	if !ok {
+		return 0
+	}
+
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	return ch.fillN(dst, hash)
 }
 
 // GetString gets the closest item in the hash ring to the provided key
+// it returns "" if there is no item, use GetString2 if the ring might contain an empty item
 func (ch *ConsistentHash) GetString(key string) string {
-	if v := ch.Get([]byte(key)); v != nil {
-		return string(v)
+	v, _ := ch.GetString2(key)
+	return v
+}
+
+// GetString2 gets the closest item in the hash ring to the provided key and whether it's found
+// an empty item (WithAllowEmptyKeys) is returned as "" with true
+func (ch *ConsistentHash) GetString2(key string) (string, bool) {
+	// empty items are stored as empty non-nil slices
+	if v := ch.Get([]byte(ch.normalize(key))); v != nil {
+		return string(v), true
 	}
-	return ""
+	return "", false
 }
 
-// Remove removes the key from hash table
-func (ch *ConsistentHash) Remove(key []byte) bool {
-	if ch.IsEmpty() {
-		return true
+// AddString adds some string keys to the hash, keys are normalized WithKeyNormalizer
+func (ch *ConsistentHash) AddString(keys ...string) {
+	bs := make([][]byte, len(keys))
+	for i := range keys {
+		bs[i] = []byte(ch.normalize(keys[i]))
+	}
+	ch.Add(bs...)
+}
+
+// RemoveString removes the string key from hash table, the key is normalized WithKeyNormalizer
+func (ch *ConsistentHash) RemoveString(key string) bool {
+	return ch.Remove([]byte(ch.normalize(key)))
+}
+
+// normalize applies the key normalizer to the string keys
+func (ch *ConsistentHash) normalize(key string) string {
+	if ch.keyNormalizer == nil {
+		return key
 	}
+	return ch.keyNormalizer(key)
+}
+
+// AddComposite adds a key made of the given parts joined by compositeSeparator
+func (ch *ConsistentHash) AddComposite(parts ...[]byte) {
+	ch.Add(joinComposite(parts))
+}
 
-	originalHash := ch.hash(key)
+// GetComposite finds the closest item to the key made of the given parts, the same way as AddComposite
+func (ch *ConsistentHash) GetComposite(parts ...[]byte) []byte {
+	return ch.Get(joinComposite(parts))
+}
+
+// joinComposite joins the parts with compositeSeparator
+func joinComposite(parts [][]byte) []byte {
+	if len(parts) == 0 {
+		return nil
+	}
+	size := len(parts) - 1
+	for _, part := range parts {
+		size += len(part)
+	}
+	key := make([]byte, 0, size)
+	for i, part := range parts {
+		if i > 0 {
+			key = append(key, compositeSeparator)
+		}
+		key = append(key, part...)
+	}
+	return key
+}
+
+// Remove removes the key from hash table
+func (ch *ConsistentHash) Remove(key []byte) bool {
+	// hashed before locking, so a panicking hash function doesn't leave the lock held
+	hash := ch.hash(key)
 
 	ch.mu.RLock()
-	if _, ok := ch.hashMap[originalHash]; !ok {
+	if ch.totalKeys == 0 {
+		ch.mu.RUnlock()
+		return true
+	}
+	originalHash, existing, ok := ch.identifyHash(hash, key)
+	if !ok || (ch.chains != nil && !bytes.Equal(existing, key)) {
 		ch.mu.RUnlock()
 		return false
 	}
@@ -131,74 +662,649 @@ func (ch *ConsistentHash) Remove(key []byte) bool {
 	}
 	ch.mu.RUnlock()
 
-	nodes := make([]node, replicas, replicas) // todo avoid overflow
+	nodes := ch.appendSalted(make([]node, 0, nodesCap(1, replicas)), originalHash, key, replicas, 0)
 
-	nodes[0] = node{originalHash, originalHash}
-	var hash uint32
-	var i uint32
+	ch.lock()
+	defer ch.unlock()
+	return ch.removeKey(key, originalHash, replicas, found, nodes)
+}
 
-	for i = 1; i < uint32(replicas); i++ {
-		var b bytes.Buffer
-		b.Write(key)
-		b.Write([]byte{byte(i), byte(i >> 8), byte(i >> 16), byte(i >> 24)})
-		hash = ch.hash(b.Bytes())
-		nodes[i] = node{hash, originalHash}
+// removeKey removes the key with the positions found for the original hash and replicas before locking,
+// they are found again if the key is changed meanwhile, the write lock must be held
+func (ch *ConsistentHash) removeKey(key []byte, originalHash uint32, replicas uint, found bool, nodes []node) bool {
+	current, existing, ok := ch.identify(key)
+	if !ok || (ch.chains != nil && !bytes.Equal(existing, key)) {
+		// removed meanwhile
+		return false
 	}
-
-	ch.mu.Lock()
-	defer ch.mu.Unlock()
+	if current != originalHash {
+		// moved meanwhile by a colliding key
+		originalHash = current
+		replicas, found = ch.replicaMap[originalHash]
+		if !found {
+			replicas = ch.replicas
+		}
+		nodes = ch.appendSalted(nodes[:0], originalHash, key, replicas, 0)
+	}
+	if !found && replicas != ch.replicas {
+		// the default number of replicas is scaled meanwhile
+		replicas = ch.replicas
+		nodes = ch.appendSalted(nodes[:0], originalHash, key, replicas, 0)
+	}
+	if salt, ok := ch.salts[originalHash]; ok {
+		// the replicas are moved by Rehash
+		nodes = ch.appendSalted(nodes[:0], originalHash, key, replicas, salt)
+		delete(ch.salts, originalHash)
+	}
+	ch.unchain(originalHash, key)
+	delete(ch.tiers, originalHash)
+	delete(ch.addedAt, originalHash)
 	if found {
 		delete(ch.replicaMap, originalHash) // delete replica numbers
 	}
+	var missing int
 	for _, n := range nodes {
-		ch.remove(n.key, n.pointer)
+		if !ch.remove(n.key, n.pointer) {
+			missing++
+		}
+	}
+	if missing > 0 {
+		// positions taken by other keys when they collided while adding
+		ch.logf("consistenthash: %d of %d positions of %q were not found", missing, len(nodes), key)
+	}
+	ch.emit(EventRemoved, ch.hashMap[originalHash])
+	if ch.loads != nil {
+		ch.loads.Delete(string(ch.hashMap[originalHash]))
 	}
+	delete(ch.hashMap, originalHash)
 
+	if ch.lazyRebuild > 0 {
+		ch.removals++
+		if ch.removals < ch.lazyRebuild {
+			// blocks are still valid, just bigger than needed
+			ch.scaleReplicas()
+			return true
+		}
+		ch.removals = 0
+	}
+	if ch.adaptiveBlocks {
+		ch.adaptBlocks(ch.totalKeys)
+	}
 	expectedBlocks := ch.totalKeys / ch.blockPartitioning
 	if expectedBlocks > 0 {
 		ch.balanceBlocks(expectedBlocks)
 	}
+	ch.scaleReplicas()
 	return true
 }
 
-// add inserts new hashes in hash table
-func (ch *ConsistentHash) add(replicas uint, keys ...[]byte) {
-	var hash uint32
-	var i uint32
-	var h bytes.Buffer
-	nodes := make([]node, 0, uint(len(keys))*replicas) // todo avoid overflow
-	for idx := range keys {
-		originalHash := ch.hash(keys[idx])
-		// no need for extra capacity, just get the bytes we need
-		ch.mu.Lock()
-		ch.hashMap[originalHash] = keys[idx][:len(keys[idx]):len(keys[idx])]
-		ch.mu.Unlock()
-		nodes = append(nodes, node{originalHash, originalHash})
-		for i = 1; i < uint32(replicas); i++ {
-			h.Write(keys[idx])
-			h.WriteByte(byte(i))
-			h.WriteByte(byte(i >> 8))
-			h.WriteByte(byte(i >> 16))
-			h.WriteByte(byte(i >> 24))
-			hash = ch.hash(h.Bytes())
-			h.Reset()
-			nodes = append(nodes, node{hash, originalHash})
+// Snapshot returns copies of the sorted positions in the ring and the hash table
+// changing the returned values doesn't affect the ring
+func (ch *ConsistentHash) Snapshot() ([]uint32, map[uint32][]byte) {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	positions := make([]uint32, 0, ch.totalKeys)
+	for blockNumber := uint32(0); blockNumber < ch.totalBlocks; blockNumber++ {
+		for _, n := range ch.blocks[blockNumber] {
+			positions = append(positions, n.key)
+		}
+	}
+
+	table := make(map[uint32][]byte, len(ch.hashMap))
+	for hash, value := range ch.hashMap {
+		table[hash] = append([]byte(nil), value...)
+	}
+	return positions, table
+}
+
+// Fingerprint returns a hash of all the positions in the ring and the items they point to
+// rings with the same fingerprint route every key to the same item
+func (ch *ConsistentHash) Fingerprint() uint64 {
+	h := fnv.New64a()
+	var b [8]byte
+
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	for blockNumber := uint32(0); blockNumber < ch.totalBlocks; blockNumber++ {
+		for _, n := range ch.blocks[blockNumber] {
+			value := ch.hashMap[n.pointer]
+			binary.BigEndian.PutUint32(b[:4], n.key)
+			binary.BigEndian.PutUint32(b[4:], uint32(len(value)))
+			h.Write(b[:])
+			h.Write(value)
+		}
+	}
+	return h.Sum64()
+}
+
+// MembershipDigest returns a hash of the items and their number of replicas, independent of their positions
+// rings with the same items and replicas have the same digest regardless of the hash function or other options
+func (ch *ConsistentHash) MembershipDigest() [16]byte {
+	type member struct {
+		key      []byte
+		replicas uint
+	}
+
+	ch.mu.RLock()
+	members := make([]member, 0, len(ch.hashMap))
+	for originalHash, key := range ch.hashMap {
+		members = append(members, member{key, ch.replicasOf(originalHash)})
+	}
+	ch.mu.RUnlock()
+
+	sort.Slice(members, func(i, j int) bool {
+		return bytes.Compare(members[i].key, members[j].key) < 0
+	})
+	h := fnv.New128a()
+	var b [8]byte
+	for _, m := range members {
+		// the length separates the keys, so different splits of the same bytes don't collide
+		binary.BigEndian.PutUint64(b[:], uint64(len(m.key)))
+		h.Write(b[:])
+		h.Write(m.key)
+		binary.BigEndian.PutUint64(b[:], uint64(m.replicas))
+		h.Write(b[:])
+	}
+	var digest [16]byte
+	h.Sum(digest[:0])
+	return digest
+}
+
+// Validate checks the consistency of the internal structures and returns the first problem found
+func (ch *ConsistentHash) Validate() error {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	var total uint32
+	var previous node
+	if len(ch.blocks) != int(ch.totalBlocks) {
+		return fmt.Errorf("consistenthash: found %d blocks, expected %d", len(ch.blocks), ch.totalBlocks)
+	}
+	if ch.values != nil && len(ch.values) != int(ch.totalBlocks) {
+		return fmt.Errorf("consistenthash: found %d value blocks, expected %d", len(ch.values), ch.totalBlocks)
+	}
+	for blockNumber := uint32(0); blockNumber < ch.totalBlocks; blockNumber++ {
+		for _, n := range ch.blocks[blockNumber] {
+			if b := ch.blockNumberOf(n.key, ch.totalBlocks); b != blockNumber {
+				return fmt.Errorf("consistenthash: key %d is stored in block %d instead of %d", n.key, blockNumber, b)
+			}
+			if total > 0 && n.key <= previous.key {
+				return fmt.Errorf("consistenthash: key %d is not sorted after key %d", n.key, previous.key)
+			}
+			if _, ok := ch.hashMap[n.pointer]; !ok {
+				return fmt.Errorf("consistenthash: key %d points to missing item %d", n.key, n.pointer)
+			}
+			previous = n
+			total++
+		}
+	}
+	if total != ch.totalKeys {
+		return fmt.Errorf("consistenthash: found %d keys in blocks, expected %d", total, ch.totalKeys)
+	}
+	return nil
+}
+
+// Prewarm rebalances the blocks for the current number of keys and warms up the pool,
+// so the first lookups after a bulk Add are not paying for any lazy setup
+func (ch *ConsistentHash) Prewarm() {
+	ch.lock()
+	defer ch.unlock()
+	expectedBlocks := ch.totalKeys / ch.blockPartitioning
+	if expectedBlocks > 0 && expectedBlocks != ch.totalBlocks {
+		ch.resizeBlocks(expectedBlocks)
+	}
+	// enough capacity to double the blocks without allocating
+	pooled := ch.pool.Get().(*[][]node)
+	if cap(*pooled) < int(ch.totalBlocks)*2 {
+		*pooled = make([][]node, 0, ch.totalBlocks*2)
+	}
+	ch.pool.Put(pooled)
+}
+
+// Merge adds all the keys of the other ring that don't exist in this ring, keeping their number of replicas
+// keys that already exist in this ring keep their current number of replicas, nothing is added if it exceeds the capacity (WithCapacity)
+func (ch *ConsistentHash) Merge(other *ConsistentHash) {
+	if ch == other {
+		return
+	}
+	// always lock the rings in the same order to avoid deadlocks between concurrent merges
+	if uintptr(unsafe.Pointer(ch)) < uintptr(unsafe.Pointer(other)) {
+		ch.lock()
+		other.mu.RLock()
+	} else {
+		other.mu.RLock()
+		ch.lock()
+	}
+	defer ch.unlock()
+	defer other.mu.RUnlock()
+
+	var missing []WeightedKey
+	var growth int
+	for originalHash, key := range other.hashMap {
+		if !ch.allowEmptyKeys && len(key) == 0 {
+			continue
+		}
+		if _, existing, ok := ch.identify(key); ok && (ch.chains == nil || bytes.Equal(existing, key)) {
+			continue
 		}
+		replicas := ch.clampReplicasLocked(other.replicasOf(originalHash))
+		missing = append(missing, WeightedKey{Key: key, Replicas: replicas})
+		growth += int(replicas)
+	}
+	if len(missing) == 0 || !ch.fits(growth) {
+		return
+	}
+	for _, entry := range missing {
+		ch.addKeys(entry.Replicas, [][]byte{entry.Key}, ch.appendNodes(make([]node, 0, nodesCap(1, entry.Replicas)), entry.Key, entry.Replicas))
+	}
+	ch.scaleReplicas()
+}
+
+// lock takes the write lock, which is also taking all the reader locks of WithShardedReadLocks
+func (ch *ConsistentHash) lock() {
+	ch.mu.Lock()
+	for i := range ch.readLocks {
+		ch.readLocks[i].Lock()
+	}
+}
+
+// unlock releases the write lock, writes the logs and sends the events collected while holding it
+func (ch *ConsistentHash) unlock() {
+	ch.generation++
+	logs, events := ch.logs, ch.pending
+	ch.logs, ch.pending = nil, nil
+	for i := range ch.readLocks {
+		ch.readLocks[i].Unlock()
+	}
+	ch.mu.Unlock()
+	for _, l := range logs {
+		ch.logger(l.format, l.args...)
+	}
+	ch.sendEvents(events)
+}
+
+// logf collects a log to be written after releasing the lock, the write lock must be held
+func (ch *ConsistentHash) logf(format string, args ...any) {
+	if ch.logger != nil {
+		ch.logs = append(ch.logs, logEntry{format, args})
+	}
+}
+
+// add inserts new hashes in hash table, the keys are stored without copying if share is set
+func (ch *ConsistentHash) add(replicas uint, share bool, keys ...[]byte) error {
+	pooled := ch.getNodes(nodesCap(len(keys), replicas))
+	nodes := *pooled
+	for idx := range keys {
+		nodes = ch.appendNodes(nodes, keys[idx], replicas)
+	}
+	defer ch.putNodes(pooled, nodes)
 
-		// do not store number of replicas if uses default number
-		if replicas != ch.replicas {
-			ch.mu.Lock()
-			ch.replicaMap[hash] = replicas
-			ch.mu.Unlock()
+	ch.lock()
+	defer ch.unlock()
+	if !ch.fits(ch.keysGrowth(keys, nodes, replicas)) {
+		return ErrCapacityExceeded
+	}
+	ch.sharing = share
+	ch.addKeys(replicas, keys, nodes)
+	ch.sharing = false
+	ch.scaleReplicas()
+	return nil
+}
+
+// addScaled adds keys with the default number of replicas while holding the lock, as the default is scaled by number of keys
+func (ch *ConsistentHash) addScaled(share bool, keys ...[]byte) error {
+	ch.lock()
+	defer ch.unlock()
+	pooled := ch.getNodes(nodesCap(len(keys), ch.replicas))
+	nodes := *pooled
+	for idx := range keys {
+		nodes = ch.appendNodes(nodes, keys[idx], ch.replicas)
+	}
+	defer ch.putNodes(pooled, nodes)
+	if !ch.fits(ch.keysGrowth(keys, nodes, ch.replicas)) {
+		return ErrCapacityExceeded
+	}
+	ch.sharing = share
+	ch.addKeys(ch.replicas, keys, nodes)
+	ch.sharing = false
+	ch.scaleReplicas()
+	return nil
+}
+
+// getNodes returns an empty buffer of nodes from the pool with at least the given capacity
+func (ch *ConsistentHash) getNodes(capacity int) *[]node {
+	pooled := ch.nodePool.Get().(*[]node)
+	if cap(*pooled) < capacity {
+		*pooled = make([]node, 0, capacity)
+	}
+	*pooled = (*pooled)[:0]
+	return pooled
+}
+
+// putNodes returns the buffer of nodes to the pool once they are added, buffers bigger than maxPreallocNodes
+// are left to the garbage collector to not keep the memory of a bulk add
+func (ch *ConsistentHash) putNodes(pooled *[]node, nodes []node) {
+	if cap(nodes) > maxPreallocNodes {
+		return
+	}
+	*pooled = nodes[:0]
+	ch.nodePool.Put(pooled)
+}
+
+// scaleReplicas changes the default number of replicas to keep total virtual nodes around maxVirtualNodes
+// and regenerates the nodes if it's changed, the write lock must be held
+func (ch *ConsistentHash) scaleReplicas() {
+	if ch.maxVirtualNodes == 0 || ch.multiProbe > 0 || len(ch.hashMap) == 0 {
+		return
+	}
+	replicas := ch.maxVirtualNodes / uint(len(ch.hashMap))
+	if replicas < 1 {
+		replicas = 1
+	}
+	if replicas == ch.replicas {
+		return
+	}
+	ch.logf("consistenthash: scaling default replicas from %d to %d for %d keys", ch.replicas, replicas, len(ch.hashMap))
+	ch.replicas = replicas
+	ch.rebuild()
+}
+
+// rebuild regenerates the nodes of all the keys in hash table, the write lock must be held
+func (ch *ConsistentHash) rebuild() {
+	nodes := make([]node, 0, ch.totalKeys)
+	for originalHash, key := range ch.hashMap {
+		replicas, found := ch.replicaMap[originalHash]
+		if !found {
+			replicas = ch.replicas
 		}
+		nodes = ch.appendSalted(nodes, originalHash, key, replicas, ch.salts[originalHash])
+	}
+
+	ch.blocks = make([][]node, 1)
+	if ch.values != nil {
+		ch.values = make([][][]byte, 1)
+	}
+	ch.totalBlocks = 1
+	ch.totalKeys = 0
+	if ch.occupied != nil {
+		ch.resetOccupied()
+	}
+	if ch.arcCoverage != nil {
+		// a new map, as the previous one might still be read by EqualizeArcs
+		ch.arcCoverage = make(map[uint32]uint64, len(ch.hashMap))
 	}
 	ch.addNodes(nodes)
 }
 
+// addKeys stores the keys in hash table and adds their nodes to the blocks, the write lock must be held
+// nodes must contain "replicas" number of nodes for each key in the same order as keys
+func (ch *ConsistentHash) addKeys(replicas uint, keys [][]byte, nodes []node) {
+	for idx := range keys {
+		originalHash := ch.storeKey(nodes[uint(idx)*replicas].key, keys[idx], replicas)
+		ch.placeNodes(nodes[uint(idx)*replicas:uint(idx+1)*replicas], originalHash, keys[idx])
+	}
+	ch.addNodes(ch.dropReplaced(nodes, len(keys), func(idx int) ([]byte, uint) { return keys[idx], replicas }))
+}
+
+// dropReplaced removes the nodes of the keys replaced by a colliding key later in the same batch, as they would point
+// to the other key, entry returns each of the count keys and its number of nodes in nodes, the write lock must be held
+func (ch *ConsistentHash) dropReplaced(nodes []node, count int, entry func(idx int) ([]byte, uint)) []node {
+	var offset uint
+	var kept []node
+	for idx := 0; idx < count; idx++ {
+		key, replicas := entry(idx)
+		if replicas == 0 {
+			continue
+		}
+		own := nodes[offset : offset+replicas]
+		offset += replicas
+		if bytes.Equal(ch.hashMap[own[0].pointer], key) {
+			if kept != nil {
+				kept = append(kept, own...)
+			}
+			continue
+		}
+		if kept == nil {
+			// copy to not change the nodes of the keys before
+			kept = append(make([]node, 0, len(nodes)), nodes[:offset-replicas]...)
+		}
+	}
+	if kept == nil {
+		return nodes
+	}
+	return kept
+}
+
+// storeKey stores the key and its number of replicas in hash table and returns the hash it's stored by,
+// which is the given hash unless the key is chained, the write lock must be held
+func (ch *ConsistentHash) storeKey(originalHash uint32, key []byte, replicas uint) uint32 {
+	if key == nil {
+		// nil and empty keys are the same
+		key = []byte{}
+	}
+	existing, ok := ch.hashMap[originalHash]
+	if ok && ch.chains != nil && !bytes.Equal(existing, key) {
+		originalHash = ch.chainKey(originalHash, key, existing)
+		existing, ok = ch.hashMap[originalHash]
+	}
+	replaced := ok && !bytes.Equal(existing, key)
+	if replaced {
+		ch.logf("consistenthash: hash %d of %q collides with %q, replacing it", originalHash, key, existing)
+		ch.dropKey(originalHash, existing)
+	} else if previous := ch.replicasOf(originalHash); ok && previous > replicas {
+		// added again with less replicas, the extra replicas would be left behind on Remove
+		for _, n := range ch.appendSalted(make([]node, 0, nodesCap(1, previous)), originalHash, key, previous, ch.salts[originalHash])[replicas:] {
+			ch.remove(n.key, n.pointer)
+		}
+	}
+	if ch.copyKeys && !ch.sharing {
+		key = append(make([]byte, 0, len(key)), key...)
+	}
+	// no need for extra capacity, just get the bytes we need
+	ch.hashMap[originalHash] = key[:len(key):len(key)]
+	if !ok || replaced {
+		ch.emit(EventAdded, ch.hashMap[originalHash])
+	}
+	if ch.addedAt != nil && (!ok || replaced) {
+		// the age of a key added again is kept, a replaced key is a new one
+		ch.addedAt[originalHash] = time.Now()
+	}
+
+	// do not store number of replicas if uses default number
+	if replicas != ch.replicas {
+		ch.replicaMap[originalHash] = replicas
+	} else {
+		delete(ch.replicaMap, originalHash)
+	}
+	return originalHash
+}
+
+// dropKey removes the positions of the key replaced by a colliding key and everything kept for it by its hash,
+// except its entries in the hash table, the write lock must be held
+func (ch *ConsistentHash) dropKey(originalHash uint32, key []byte) {
+	replicas := ch.replicasOf(originalHash)
+	for _, n := range ch.appendSalted(make([]node, 0, nodesCap(1, replicas)), originalHash, key, replicas, ch.salts[originalHash]) {
+		ch.remove(n.key, n.pointer)
+	}
+	delete(ch.salts, originalHash)
+	delete(ch.tiers, originalHash)
+	if ch.loads != nil {
+		ch.loads.Delete(string(key))
+	}
+	ch.emit(EventRemoved, key)
+}
+
+// placeNodes generates the nodes of the key again if it's chained or rehashed, as the nodes are generated
+// before taking the lock by the hash of the key without the salt, the nodes are replaced in place, the write lock must be held
+func (ch *ConsistentHash) placeNodes(nodes []node, originalHash uint32, key []byte) {
+	if salt, ok := ch.salts[originalHash]; ok || nodes[0].pointer != originalHash {
+		ch.appendSalted(nodes[:0], originalHash, key, uint(len(nodes)), salt)
+	}
+}
+
+// identify returns the hash the key is stored by, which is the hash of the key unless it's chained,
+// and the key stored by that hash if there is any, the lock must be held
+func (ch *ConsistentHash) identify(key []byte) (uint32, []byte, bool) {
+	return ch.identifyHash(ch.hash(key), key)
+}
+
+// identifyHash is the same as identify with the hash of the key, so the key can be hashed before locking
+func (ch *ConsistentHash) identifyHash(originalHash uint32, key []byte) (uint32, []byte, bool) {
+	existing, ok := ch.hashMap[originalHash]
+	if ch.chains == nil || (ok && bytes.Equal(existing, key)) {
+		return originalHash, existing, ok
+	}
+	for _, chained := range ch.chains[originalHash] {
+		if v := ch.hashMap[chained]; bytes.Equal(v, key) {
+			return chained, v, true
+		}
+	}
+	return originalHash, existing, ok
+}
+
+// replicasOf returns the number of replicas of the stored key, the lock must be held
+func (ch *ConsistentHash) replicasOf(originalHash uint32) uint {
+	if replicas, found := ch.replicaMap[originalHash]; found {
+		return replicas
+	}
+	return ch.replicas
+}
+
+// filterKeys removes the empty keys if they are not allowed, and the keys the hash function panics on
+// with WithRecoverHashPanics
+func (ch *ConsistentHash) filterKeys(keys [][]byte) [][]byte {
+	if ch.allowEmptyKeys && !ch.recoverHashPanics {
+		return keys
+	}
+	for i := range keys {
+		if ch.acceptKey(keys[i]) {
+			continue
+		}
+		// copy to not change the given keys
+		filtered := make([][]byte, i, len(keys)-1)
+		copy(filtered, keys[:i])
+		for _, key := range keys[i+1:] {
+			if ch.acceptKey(key) {
+				filtered = append(filtered, key)
+			}
+		}
+		return filtered
+	}
+	return keys
+}
+
+// acceptKey checks the key can be added, it's not empty unless allowed and can be hashed
+func (ch *ConsistentHash) acceptKey(key []byte) bool {
+	if !ch.allowEmptyKeys && len(key) == 0 {
+		return false
+	}
+	if ch.recoverHashPanics {
+		_, ok := ch.hashSafely(key)
+		return ok
+	}
+	return true
+}
+
+// clampReplicas limits the number of replicas to maxReplicas, or to 1 with multi-probe
+// it might call the logger, so the lock must not be held, use clampReplicasLocked while holding it
+func (ch *ConsistentHash) clampReplicas(replicas uint) uint {
+	clamped, exceeded := ch.clamp(replicas)
+	if exceeded && ch.logger != nil {
+		ch.logger("consistenthash: clamping %d replicas to %d", replicas, uint64(maxReplicas))
+	}
+	return clamped
+}
+
+// clampReplicasLocked is the same as clampReplicas, the log is written after releasing the lock, the write lock must be held
+func (ch *ConsistentHash) clampReplicasLocked(replicas uint) uint {
+	clamped, exceeded := ch.clamp(replicas)
+	if exceeded {
+		ch.logf("consistenthash: clamping %d replicas to %d", replicas, uint64(maxReplicas))
+	}
+	return clamped
+}
+
+// clamp limits the number of replicas and returns whether it exceeds maxReplicas
+func (ch *ConsistentHash) clamp(replicas uint) (uint, bool) {
+	if ch.multiProbe > 0 && replicas > 1 {
+		return 1, false
+	}
+	if uint64(replicas) <= maxReplicas {
+		return replicas, false
+	}
+	return maxReplicas, true
+}
+
+// nodesCap returns the capacity to allocate for the nodes of count keys with the given number of replicas
+// it's limited to maxPreallocNodes, also when the multiplication overflows
+func nodesCap(count int, replicas uint) int {
+	if count <= 0 || replicas == 0 {
+		return 0
+	}
+	if uint64(replicas) > maxPreallocNodes/uint64(count) {
+		return maxPreallocNodes
+	}
+	return count * int(replicas)
+}
+
+// appendNodes appends the original node of the key and its replicas to the given nodes
+func (ch *ConsistentHash) appendNodes(nodes []node, key []byte, replicas uint) []node {
+	return ch.appendSalted(nodes, ch.hash(key), key, replicas, 0)
+}
+
+// appendSalted appends the nodes of the key stored by the original hash like appendNodes,
+// the salt moves the replicas of a rehashed key
+func (ch *ConsistentHash) appendSalted(nodes []node, originalHash uint32, key []byte, replicas uint, salt uint32) []node {
+	var i uint32
+	nodes = append(nodes, node{originalHash, originalHash})
+	if replicas < 2 {
+		return nodes
+	}
+	if ch.nodeHasher != nil {
+		for i = 1; i < uint32(replicas); i++ {
+			position := ch.nodeHasher(key, i)
+			if salt > 0 {
+				position = fmix32(position + salt*probeStep)
+			}
+			if ch.replicaJitter {
+				position = fmix32(position ^ ch.jitterSeed)
+			}
+			nodes = append(nodes, node{ch.fold(position), originalHash})
+		}
+		return nodes
+	}
+	h := ch.buffers.Get().(*bytes.Buffer)
+	defer ch.buffers.Put(h)
+	for i = 1; i < uint32(replicas); i++ {
+		h.Write(key)
+		h.WriteByte(byte(i))
+		h.WriteByte(byte(i >> 8))
+		h.WriteByte(byte(i >> 16))
+		h.WriteByte(byte(i >> 24))
+		if salt > 0 {
+			h.WriteByte(byte(salt))
+			h.WriteByte(byte(salt >> 8))
+			h.WriteByte(byte(salt >> 16))
+			h.WriteByte(byte(salt >> 24))
+		}
+		position := ch.hash(h.Bytes())
+		if ch.replicaJitter {
+			position = ch.fold(fmix32(position ^ ch.jitterSeed))
+		}
+		nodes = append(nodes, node{position, originalHash})
+		h.Reset()
+	}
+	return nodes
+}
+
+// addNodes adds the nodes to the blocks, the write lock must be held
 func (ch *ConsistentHash) addNodes(nodes []node) {
+	if ch.adaptiveBlocks {
+		ch.adaptBlocks(ch.totalKeys + uint32(len(nodes)))
+	}
 	expectedBlocks := (ch.totalKeys + uint32(len(nodes))) / ch.blockPartitioning
-	ch.mu.Lock()
-	defer ch.mu.Unlock()
 	ch.balanceBlocks(expectedBlocks)
 	for i := range nodes {
 		ch.addNode(nodes[i])
@@ -206,27 +1312,36 @@ func (ch *ConsistentHash) addNodes(nodes []node) {
 }
 
 func (ch *ConsistentHash) addNode(n node) {
-	blockSize := math.MaxUint32 / ch.totalBlocks
-	blockNumber := n.key / blockSize
-	nodes, ok := ch.blockMap[blockNumber]
-	if !ok {
-		ch.blockMap[blockNumber] = []node{n}
-		ch.totalKeys++
-		return
-	}
+	blockNumber := ch.blockNumberOf(n.key, ch.totalBlocks)
+	nodes := ch.blocks[blockNumber]
 	idx := sort.Search(len(nodes), func(i int) bool {
 		return nodes[i].key >= n.key
 	})
 
 	// check for duplication, ignore if it's duplicate
 	if idx < len(nodes) && nodes[idx].key == n.key {
+		if nodes[idx].pointer != n.pointer {
+			ch.logf("consistenthash: position %d of %q collides with %q", n.key, ch.hashMap[n.pointer], ch.hashMap[nodes[idx].pointer])
+		}
 		return
 	}
 
-	ch.blockMap[blockNumber] = append(ch.blockMap[blockNumber], node{})
-	copy(ch.blockMap[blockNumber][idx+1:], ch.blockMap[blockNumber][idx:])
-	ch.blockMap[blockNumber][idx] = n
+	ch.blocks[blockNumber] = append(ch.blocks[blockNumber], node{})
+	copy(ch.blocks[blockNumber][idx+1:], ch.blocks[blockNumber][idx:])
+	ch.blocks[blockNumber][idx] = n
+	if ch.occupied != nil {
+		ch.markOccupied(blockNumber, true)
+	}
+	if ch.values != nil {
+		values := append(ch.values[blockNumber], nil)
+		copy(values[idx+1:], values[idx:])
+		values[idx] = ch.hashMap[n.pointer]
+		ch.values[blockNumber] = values
+	}
 	ch.totalKeys++
+	if ch.arcCoverage != nil {
+		ch.coverAdded(blockNumber, idx)
+	}
 }
 
 // balanceBlocks checks all the keys in each block and shifts to the next block if the number of blocks needs to be changed
@@ -234,39 +1349,14 @@ func (ch *ConsistentHash) balanceBlocks(expectedBlocks uint32) {
 	if expectedBlocks < 1 {
 		return
 	}
-	// re-balance the blocks if expectedBlocks needs twice size as it's current size
-	if (expectedBlocks>>1) > ch.totalBlocks || expectedBlocks < (ch.totalBlocks>>1) {
-		blockSize := math.MaxUint32 / expectedBlocks
-		newBlockMap := ch.pool.Get().(map[uint32][]node)
-		for blockNumber := ch.totalBlocks; blockNumber >= 0; blockNumber-- {
-			nodes := ch.blockMap[blockNumber]
-			var j int
-			for i := len(nodes) - 1; i > 0; i-- {
-				targetBlock := nodes[i].key / blockSize
-				if targetBlock == blockNumber {
-					newBlockMap[blockNumber] = nodes[:i]
-					break
-				}
-				for j = i; j > 0; j-- {
-					if nodes[j].key/blockSize != targetBlock {
-						break
-					}
-				}
-				// shift and prepend nodes to the target block
-				newBlockMap[targetBlock] = append(newBlockMap[targetBlock], make([]node, i-j)...)
-				copy(newBlockMap[targetBlock][i-j:], newBlockMap[targetBlock])
-				copy(newBlockMap[targetBlock][:i-j], nodes[j:i-1])
-				// newBlockMap[targetBlock] = append(nodes[j:i-1], newBlockMap[targetBlock]...)
-
-				i = j
-			}
-			if blockNumber == 0 {
-				break
-			}
+	if ch.rebuildThreshold > 0 {
+		// re-balance the blocks if the number of keys is changed by more than the threshold since the last resize
+		if math.Abs(float64(expectedBlocks)-float64(ch.totalBlocks)) > ch.rebuildThreshold*float64(ch.totalBlocks) {
+			ch.resizeBlocks(expectedBlocks)
 		}
-		ch.blockMap = newBlockMap
-		ch.totalBlocks = expectedBlocks
-		ch.pool.Put(newBlockMap)
+	} else if (expectedBlocks>>1) > ch.totalBlocks || expectedBlocks < (ch.totalBlocks>>1) {
+		// re-balance the blocks if expectedBlocks needs twice size as it's current size
+		ch.resizeBlocks(expectedBlocks)
 	}
 
 	if ch.totalBlocks < 1 {
@@ -274,77 +1364,328 @@ func (ch *ConsistentHash) balanceBlocks(expectedBlocks uint32) {
 	}
 }
 
-// remove removes one key from a block
-func (ch *ConsistentHash) remove(hash, originalHash uint32) {
-	blockSize := math.MaxUint32 / ch.totalBlocks
-	blockNumber := hash / blockSize
-	nodes, ok := ch.blockMap[blockNumber]
-	if !ok {
-		return
+// resizeBlocks moves all the keys to the blocks they belong to with the given number of blocks
+func (ch *ConsistentHash) resizeBlocks(expectedBlocks uint32) {
+	ch.logf("consistenthash: resizing blocks from %d to %d for %d keys", ch.totalBlocks, expectedBlocks, ch.totalKeys)
+	pooled := ch.pool.Get().(*[][]node)
+	newBlocks := *pooled
+	if cap(newBlocks) < int(expectedBlocks) {
+		newBlocks = make([][]node, expectedBlocks)
+	}
+	newBlocks = newBlocks[:expectedBlocks]
+	var newValues [][][]byte
+	if ch.values != nil {
+		newValues = make([][][]byte, expectedBlocks)
 	}
+	// blocks are visited in order and keys are sorted in each block, so appending keeps the new blocks sorted
+	for blockNumber := uint32(0); blockNumber < ch.totalBlocks; blockNumber++ {
+		for i, n := range ch.blocks[blockNumber] {
+			targetBlock := ch.blockNumberOf(n.key, expectedBlocks)
+			newBlocks[targetBlock] = append(newBlocks[targetBlock], n)
+			if newValues != nil {
+				newValues[targetBlock] = append(newValues[targetBlock], ch.values[blockNumber][i])
+			}
+		}
+	}
+
+	// the old blocks are not referenced anymore, so the slice can be reused by the next resize
+	for blockNumber := range ch.blocks {
+		ch.blocks[blockNumber] = nil
+	}
+	*pooled = ch.blocks[:0]
+	ch.pool.Put(pooled)
+
+	ch.blocks = newBlocks
+	ch.values = newValues
+	ch.totalBlocks = expectedBlocks
+	if ch.occupied != nil {
+		ch.resetOccupied()
+	}
+}
 
-	ln := len(nodes)
-	idx := sort.Search(ln, func(i int) bool {
+// remove removes one key from a block if it belongs to the given original hash, returns false if it's not found
+func (ch *ConsistentHash) remove(hash, originalHash uint32) bool {
+	blockNumber := ch.blockNumberOf(hash, ch.totalBlocks)
+	nodes := ch.blocks[blockNumber]
+	idx := sort.Search(len(nodes), func(i int) bool {
 		return nodes[i].key >= hash
 	})
-	if idx == ln {
-		ch.blockMap[blockNumber] = ch.blockMap[blockNumber][:idx]
-	} else {
-		ch.blockMap[blockNumber] = append(ch.blockMap[blockNumber][:idx], ch.blockMap[blockNumber][idx+1:]...) // remove item
+	// the position might not exist or belong to another key, if it collided while adding
+	if idx == len(nodes) || nodes[idx].key != hash || nodes[idx].pointer != originalHash {
+		return false
+	}
+	if ch.arcCoverage != nil {
+		ch.coverRemoved(blockNumber, idx)
+	}
+
+	ch.blocks[blockNumber] = append(nodes[:idx], nodes[idx+1:]...) // remove item
+	if ch.values != nil {
+		ch.values[blockNumber] = append(ch.values[blockNumber][:idx], ch.values[blockNumber][idx+1:]...)
+	}
+	if ch.occupied != nil && len(ch.blocks[blockNumber]) == 0 {
+		ch.markOccupied(blockNumber, false)
 	}
 	ch.totalKeys--
+	return true
+}
+
+// lookup finds the block number and the index of the closest key to the given hash
+func (ch *ConsistentHash) lookup(hash uint32) (uint32, int, bool) {
+	startBlock := ch.blockNumberOf(hash, ch.totalBlocks)
+	for blockNumber := startBlock; blockNumber < ch.totalBlocks; blockNumber++ {
+		if ch.maxProbeBlocks > 0 && blockNumber-startBlock == ch.maxProbeBlocks {
+			// too many empty blocks, the next occupied block has the closest key
+			if blockNumber = ch.nextOccupied(blockNumber); blockNumber == ch.totalBlocks {
+				break
+			}
+		}
+		nodes := ch.blocks[blockNumber]
+		idx := ch.search(nodes, hash)
 
-	if originalHash == hash {
-		delete(ch.hashMap, originalHash)
+		// if not found in the block, the first item from the next block is the answer
+		if idx < len(nodes) {
+			return blockNumber, idx, true
+		}
 	}
-	return
+
+	// the hash is bigger than all the keys, so the first key in the circle is the answer
+	if ch.maxProbeBlocks > 0 {
+		if blockNumber := ch.nextOccupied(0); blockNumber <= startBlock {
+			return blockNumber, 0, true
+		}
+		return startBlock, 0, false
+	}
+	for blockNumber := uint32(0); blockNumber <= startBlock; blockNumber++ {
+		if len(ch.blocks[blockNumber]) > 0 {
+			return blockNumber, 0, true
+		}
+	}
+	return startBlock, 0, false
 }
 
-// lookup finds the block number and value of the given hash
-func (ch *ConsistentHash) lookup(hash uint32) ([]byte, uint32) {
-	// binary search for appropriate replica
-	blockSize := math.MaxUint32 / ch.totalBlocks
-	blockNumber := hash / blockSize
-	var idx int
-	var fullCircle bool
-	for blockNumber < ch.totalBlocks {
-		nodes, ok := ch.blockMap[blockNumber]
+// probe returns the position of the closest key to any of the multiProbe hashes derived from the hash,
+// measured clockwise, so walking from it starts with the chosen key. Without multi-probe it returns the hash
+func (ch *ConsistentHash) probe(hash uint32) uint32 {
+	if ch.multiProbe < 2 {
+		return hash
+	}
+	var best uint32
+	var closest uint64
+	for i := 0; i < ch.multiProbe; i++ {
+		h := hash
+		if i > 0 {
+			// the probes are derived from the hash, so GetByHashHint probes the same hashes as Get
+			h = ch.fold(fmix32(hash + uint32(i)*probeStep))
+		}
+		blockNumber, idx, ok := ch.lookup(h)
 		if !ok {
-			blockNumber++
-			continue
+			return hash
 		}
-		// binary search inside the block
-		idx = sort.Search(len(nodes), func(i int) bool {
-			return nodes[i].key >= hash
-		})
+		position := ch.blocks[blockNumber][idx].key
+		// the distance wraps around the end of the circle
+		if distance := arcOf(h, position, ch.ringSize); i == 0 || distance < closest {
+			best, closest = position, distance
+		}
+	}
+	return best
+}
 
-		// if not found in the block, the first item from the next block is the answer
-		if idx == len(nodes) {
-			if blockNumber == ch.totalBlocks-1 && !fullCircle {
-				// go to the first block
-				blockNumber = 0
-				fullCircle = true
-			} else {
-				blockNumber++
+// verify checks the key at the given index of the block is the closest key to the hash in the circle
+// by comparing it with the previous key in the circle
+func (ch *ConsistentHash) verify(hash, blockNumber uint32, idx int) bool {
+	n := ch.blocks[blockNumber][idx]
+	previous := ch.previous(blockNumber, idx)
+	if n.key >= hash {
+		// either the previous key is before the hash, or the key is the first one in the circle
+		return previous.key < hash || previous.key >= n.key
+	}
+	// passed the end of the circle, the key must be the first one and the last key before the hash
+	return previous.key >= n.key && previous.key < hash
+}
+
+// previous returns the key before the given index of the block in the circle
+func (ch *ConsistentHash) previous(blockNumber uint32, idx int) node {
+	if idx > 0 {
+		return ch.blocks[blockNumber][idx-1]
+	}
+	// the last key of the previous non-empty block, ends up in the same block if it's the only one
+	for i := uint32(1); i <= ch.totalBlocks; i++ {
+		nodes := ch.blocks[(blockNumber+ch.totalBlocks-i)%ch.totalBlocks]
+		if len(nodes) > 0 {
+			return nodes[len(nodes)-1]
+		}
+	}
+	return ch.blocks[blockNumber][idx]
+}
+
+// scan finds the block number and the index of the closest key to the given hash by checking all the keys
+func (ch *ConsistentHash) scan(hash uint32) (uint32, int) {
+	var closestBlock, firstBlock uint32
+	closestIdx, firstIdx := -1, -1
+	for blockNumber := uint32(0); blockNumber < ch.totalBlocks; blockNumber++ {
+		for idx, n := range ch.blocks[blockNumber] {
+			if n.key >= hash && (closestIdx < 0 || n.key < ch.blocks[closestBlock][closestIdx].key) {
+				closestBlock, closestIdx = blockNumber, idx
+			}
+			if firstIdx < 0 || n.key < ch.blocks[firstBlock][firstIdx].key {
+				firstBlock, firstIdx = blockNumber, idx
+			}
+		}
+	}
+	if closestIdx < 0 {
+		return firstBlock, firstIdx
+	}
+	return closestBlock, closestIdx
+}
+
+// valueOf returns the value of the key at the given index of the block
+func (ch *ConsistentHash) valueOf(blockNumber uint32, idx int) []byte {
+	if ch.values != nil {
+		return ch.values[blockNumber][idx]
+	}
+	// lookup the pointer in hash table
+	return ch.hashMap[ch.blocks[blockNumber][idx].pointer]
+}
+
+// getN collects the n closest distinct items to the hash, the read lock must be held
+func (ch *ConsistentHash) getN(hash uint32, n int) [][]byte {
+	if n > len(ch.hashMap) {
+		n = len(ch.hashMap)
+	}
+	items := make([][]byte, n)
+	return items[:ch.fillN(items, hash)]
+}
+
+// fillN fills dst with the closest distinct items to the hash walking clockwise, returns the number of items
+func (ch *ConsistentHash) fillN(dst [][]byte, hash uint32) int {
+	return ch.fillFrom(dst, ch.probe(hash))
+}
+
+// fillFrom is the same as fillN starting from the position itself without probing
+func (ch *ConsistentHash) fillFrom(dst [][]byte, position uint32) int {
+	n := len(dst)
+	if n > len(ch.hashMap) {
+		n = len(ch.hashMap)
+	}
+	if n == 0 {
+		return 0
+	}
+	var count int
+	ch.walk(position, func(blockNumber uint32, idx int) bool {
+		item := ch.valueOf(blockNumber, idx)
+		// replicas point to the same item, distinct items have different values
+		for _, existing := range dst[:count] {
+			if bytes.Equal(existing, item) {
+				return true
 			}
-			continue
 		}
+		dst[count] = item
+		count++
+		return count < n
+	})
+	return count
+}
+
+// containsPointer checks if the pointer exists in the given list
+func containsPointer(pointers []uint32, pointer uint32) bool {
+	for _, p := range pointers {
+		if p == pointer {
+			return true
+		}
+	}
+	return false
+}
 
-		// lookup the pointer in hash table
-		return ch.hashMap[nodes[idx].pointer], blockNumber
+// walk calls fn with the position of each key clockwise, starting from the closest key to the hash
+// it stops when fn returns false or all the keys in the circle are visited
+func (ch *ConsistentHash) walk(hash uint32, fn func(blockNumber uint32, idx int) bool) {
+	startBlock := ch.blockNumberOf(hash, ch.totalBlocks)
+	nodes := ch.blocks[startBlock]
+	startIdx := ch.search(nodes, hash)
+	for idx := startIdx; idx < len(nodes); idx++ {
+		if !fn(startBlock, idx) {
+			return
+		}
+	}
+	// the rest of the blocks, going to the first block after the last one
+	for i := uint32(1); i < ch.totalBlocks; i++ {
+		blockNumber := (startBlock + i) % ch.totalBlocks
+		for idx := range ch.blocks[blockNumber] {
+			if !fn(blockNumber, idx) {
+				return
+			}
+		}
+	}
+	for idx := 0; idx < startIdx; idx++ {
+		if !fn(startBlock, idx) {
+			return
+		}
 	}
+}
 
-	// if we reach the last block, we need to find the first block that has an item
-	if blockNumber == ch.totalBlocks {
-		var j uint32
-		for j < uint32(len(ch.blockMap)) {
-			if len(ch.blockMap[j]) > 0 {
-				blockNumber = 0
-				firstKey := ch.blockMap[0][0].pointer
-				return ch.hashMap[firstKey], blockNumber
+// walkBack calls fn with the position of each key counter-clockwise, starting from the last key before the hash
+// it stops when fn returns false or all the keys in the circle are visited
+func (ch *ConsistentHash) walkBack(hash uint32, fn func(blockNumber uint32, idx int) bool) {
+	startBlock := ch.blockNumberOf(hash, ch.totalBlocks)
+	nodes := ch.blocks[startBlock]
+	startIdx := ch.search(nodes, hash)
+	for idx := startIdx - 1; idx >= 0; idx-- {
+		if !fn(startBlock, idx) {
+			return
+		}
+	}
+	// the rest of the blocks, going to the last block before the first one
+	for i := uint32(1); i < ch.totalBlocks; i++ {
+		blockNumber := (startBlock + ch.totalBlocks - i) % ch.totalBlocks
+		for idx := len(ch.blocks[blockNumber]) - 1; idx >= 0; idx-- {
+			if !fn(blockNumber, idx) {
+				return
 			}
-			j++
 		}
 	}
-	return nil, blockNumber
+	for idx := len(nodes) - 1; idx >= startIdx; idx-- {
+		if !fn(startBlock, idx) {
+			return
+		}
+	}
+}
+
+// search finds the index of the first node in the block with a key not less than the hash
+func (ch *ConsistentHash) search(nodes []node, hash uint32) int {
+	if ch.gallopingSearch {
+		return gallop(nodes, hash)
+	}
+	// binary search inside the block
+	return sort.Search(len(nodes), func(i int) bool {
+		return nodes[i].key >= hash
+	})
+}
+
+// gallop finds the index of the first node with a key not less than the hash
+// by doubling the range from the first node, then doing a binary search in the last range
+func gallop(nodes []node, hash uint32) int {
+	if len(nodes) == 0 || nodes[0].key >= hash {
+		return 0
+	}
+	// nodes[lo] is always less than the hash
+	lo, hi := 0, 1
+	for hi < len(nodes) && nodes[hi].key < hash {
+		lo = hi
+		hi <<= 1
+	}
+	if hi > len(nodes) {
+		hi = len(nodes)
+	}
+	return lo + 1 + sort.Search(hi-lo-1, func(i int) bool {
+		return nodes[lo+1+i].key >= hash
+	})
+}
+
+// blockOf returns the block number of the given hash when the circle is divided into totalBlocks equal blocks
+// it's hash * totalBlocks / 2^32 computed in 64bit, so it can't overflow and is always less than totalBlocks
+func blockOf(hash, totalBlocks uint32) uint32 {
+	if totalBlocks < 2 {
+		return 0
+	}
+	return uint32(uint64(hash) * uint64(totalBlocks) >> 32)
 }
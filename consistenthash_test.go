@@ -2,9 +2,15 @@ package consistenthash
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"math"
 	"math/rand"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 )
@@ -139,46 +145,1513 @@ func TestConcurrency(t *testing.T) {
 	}
 }
 
+func TestConcurrentAddRemoveGet(t *testing.T) {
+	for _, opts := range [][]Option{
+		{WithDefaultReplicas(10)},
+		{WithDefaultReplicas(10), WithArrayTable(), WithMaxProbeBlocks(2)},
+		{WithMaxVirtualNodes(100), WithResultCache([][]byte{[]byte("key-1")})},
+	} {
+		hash := New(opts...)
+		items := make(map[string]bool)
+		for i := 0; i < 20; i++ {
+			items[fmt.Sprintf("node-%d", i)] = true
+		}
+
+		var wg sync.WaitGroup
+		for w := 0; w < 4; w++ {
+			wg.Add(2)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < 500; i++ {
+					key := []byte(fmt.Sprintf("node-%d", (i*7+w)%20))
+					if i%3 == 0 {
+						hash.Remove(key)
+					} else {
+						hash.Add(key)
+					}
+				}
+			}(w)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < 500; i++ {
+					key := fmt.Sprintf("key-%d", (i+w)%10)
+					if item := hash.GetString(key); item != "" && !items[item] {
+						t.Errorf("expected one of the items, got %q", item)
+					}
+					for _, item := range hash.GetN([]byte(key), 3) {
+						if !items[string(item)] {
+							t.Errorf("expected one of the items, got %q", item)
+						}
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+		if err := hash.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 func TestConsistency(t *testing.T) {
 	hash1 := New()
 	hash2 := New()
 
-	hash1.Add([]byte("Bill"))
-	hash1.Add([]byte("Bob"))
-	hash1.Add([]byte("Bonny"))
-	hash2.Add([]byte("Bob"))
-	hash2.Add([]byte("Bonny"))
-	hash2.Add([]byte("Bill"))
+	hash1.Add([]byte("Bill"))
+	hash1.Add([]byte("Bob"))
+	hash1.Add([]byte("Bonny"))
+	hash2.Add([]byte("Bob"))
+	hash2.Add([]byte("Bonny"))
+	hash2.Add([]byte("Bill"))
+
+	if hash1.GetString("Ben") != hash2.GetString("Ben") {
+		t.Errorf("fetching 'Ben' from both hashes should be the same")
+	}
+
+	hash2.Add([]byte("Becky"))
+	hash2.Add([]byte("Ben"))
+	hash2.Add([]byte("Bobby"))
+
+	if hash1.GetString("Bill") != hash2.GetString("Bill") ||
+		hash1.GetString("Bob") != hash2.GetString("Bob") ||
+		hash1.GetString("Bonny") != hash2.GetString("Bonny") {
+		t.Errorf("direct matches should always return the same entry")
+	}
+
+}
+
+func TestBlocksAgainstSortedPositions(t *testing.T) {
+	for _, partitioning := range []int{1, 2, 7, 50} {
+		hash := New(WithDefaultReplicas(10), WithBlockPartitioning(partitioning))
+		r := rand.New(rand.NewSource(int64(partitioning)))
+		for i := 0; i < 300; i++ {
+			if i%3 == 2 {
+				hash.Remove([]byte(strconv.Itoa(r.Intn(i))))
+			} else {
+				hash.Add([]byte(strconv.Itoa(i)))
+			}
+		}
+		if err := hash.Validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		// the closest position by a binary search over all the sorted positions
+		positions, table := hash.Snapshot()
+		owners := make(map[uint32]string, len(positions))
+		for blockNumber := range hash.blocks {
+			for _, n := range hash.blocks[blockNumber] {
+				owners[n.key] = string(table[n.pointer])
+			}
+		}
+		for i := 0; i < 2000; i++ {
+			key := []byte(fmt.Sprintf("key-%d", i))
+			h := hash.hash(key)
+			idx := sort.Search(len(positions), func(i int) bool { return positions[i] >= h })
+			expected := owners[positions[idx%len(positions)]]
+			if v, ok := table[h]; ok {
+				expected = string(v)
+			}
+			if v := hash.Get(key); string(v) != expected {
+				t.Fatalf("Asking for %s with partitioning %d, should have yielded %s, got %s", key, partitioning, expected, v)
+			}
+		}
+	}
+}
+
+// identityHash parses the key as its own hash, so the positions are known
+func identityHash(key []byte) uint32 {
+	i, _ := strconv.ParseUint(string(key), 10, 32)
+	return uint32(i)
+}
+
+// checkAgainstBruteForce routes the sample hashes through the ring and compares with the nearest position clockwise
+// keys must be their own hash with 1 replica, so the positions are the keys
+func checkAgainstBruteForce(t *testing.T, name string, hash *ConsistentHash, positions map[uint32]bool, samples []uint32) {
+	t.Helper()
+	for _, sample := range samples {
+		var expected uint32
+		var found, wrapped bool
+		for p := range positions {
+			if p >= sample && (!found || p < expected) {
+				expected, found = p, true
+			}
+		}
+		if !found {
+			for p := range positions {
+				if !wrapped || p < expected {
+					expected, wrapped = p, true
+				}
+			}
+		}
+		v := hash.GetString(strconv.FormatUint(uint64(sample), 10))
+		if len(positions) == 0 {
+			if v != "" {
+				t.Fatalf("%s: expected nothing for %d in empty ring, got %s", name, sample, v)
+			}
+			continue
+		}
+		if v != strconv.FormatUint(uint64(expected), 10) {
+			t.Fatalf("%s: asking for %d, should have yielded %d, got %s", name, sample, expected, v)
+		}
+	}
+}
+
+func TestCodePathsAgainstBruteForce(t *testing.T) {
+	identity := WithHashFunc(identityHash)
+	configs := map[string][]Option{
+		"default":      nil,
+		"partition-1":  {WithBlockPartitioning(1)},
+		"partition-3":  {WithBlockPartitioning(3)},
+		"partition-1k": {WithBlockPartitioning(1000)},
+		"array-table":  {WithBlockPartitioning(2), WithArrayTable()},
+		"galloping":    {WithBlockPartitioning(4), WithGallopingSearch()},
+		"lazy-rebuild": {WithBlockPartitioning(2), WithLazyRebuild(5)},
+		"verified":     {WithBlockPartitioning(2), WithVerifiedBlocks()},
+	}
+	sequences := map[string]func(r *rand.Rand) (add bool, position uint32){
+		"random": func(r *rand.Rand) (bool, uint32) {
+			return r.Intn(3) > 0, r.Uint32()
+		},
+		"edges": func(r *rand.Rand) (bool, uint32) {
+			edges := []uint32{0, 1, 2, 1 << 31, math.MaxUint32 - 1, math.MaxUint32}
+			return r.Intn(2) > 0, edges[r.Intn(len(edges))]
+		},
+		"clustered": func(r *rand.Rand) (bool, uint32) {
+			return r.Intn(4) > 0, 1<<30 + uint32(r.Intn(1000))
+		},
+		"grow-and-shrink": func(r *rand.Rand) (bool, uint32) {
+			return r.Intn(100) < 50, uint32(r.Intn(200)) * (math.MaxUint32 / 200)
+		},
+	}
+	for seqName, next := range sequences {
+		for configName, opts := range configs {
+			name := seqName + "/" + configName
+			hash := New(append(opts, identity, WithDefaultReplicas(1))...)
+			positions := make(map[uint32]bool)
+			r := rand.New(rand.NewSource(1))
+			samples := make([]uint32, 50)
+			for i := range samples {
+				samples[i] = r.Uint32()
+			}
+			samples = append(samples, 0, 1, 1<<30, math.MaxUint32)
+			for i := 0; i < 500; i++ {
+				add, position := next(r)
+				key := []byte(strconv.FormatUint(uint64(position), 10))
+				if add {
+					hash.Add(key)
+					positions[position] = true
+				} else {
+					hash.Remove(key)
+					delete(positions, position)
+				}
+				if i%50 == 0 {
+					checkAgainstBruteForce(t, name, hash, positions, samples)
+				}
+			}
+			checkAgainstBruteForce(t, name, hash, positions, samples)
+			if err := hash.Validate(); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+	}
+}
+
+func TestReplicaJitter(t *testing.T) {
+	crcVariance := shareVariance(New(WithDefaultReplicas(100)))
+	jitterVariance := shareVariance(New(WithDefaultReplicas(100), WithReplicaJitter(42)))
+	if jitterVariance*5 > crcVariance {
+		t.Errorf("expected jitter variance %.4f to be much lower than crc32 variance %.4f", jitterVariance, crcVariance)
+	}
+
+	// the same seed makes the same ring
+	hash, other := New(WithReplicaJitter(42)), New(WithReplicaJitter(42))
+	hash.Add([]byte("host-01"), []byte("host-02"))
+	other.Add([]byte("host-01"), []byte("host-02"))
+	if hash.Fingerprint() != other.Fingerprint() {
+		t.Errorf("expected the same layout with the same seed")
+	}
+	if hash.Remove([]byte("host-01")); hash.Validate() != nil || hash.GetString("host-01") != "host-02" {
+		t.Errorf("expected all the jittered replicas to be removed")
+	}
+}
+
+// shareVariance returns the variance of the share of the circle owned by 99 hosts with a common prefix
+func shareVariance(hash *ConsistentHash) float64 {
+	hosts := 99
+	for i := 1; i <= hosts; i++ {
+		hash.Add([]byte(fmt.Sprintf("host-%02d", i)))
+	}
+	var variance float64
+	mean := float64(ringSize) / float64(hosts)
+	for _, arcs := range hash.OwnershipArcs() {
+		var total float64
+		for _, arc := range arcs {
+			total += float64(arc[1] - arc[0])
+		}
+		d := (total - mean) / mean
+		variance += d * d
+	}
+	return variance / float64(hosts)
+}
+
+func TestMultiProbe(t *testing.T) {
+	multiProbe := New(WithMurmur32(), WithMultiProbe(8), WithDefaultReplicas(50))
+	replicated := New(WithMurmur32(), WithDefaultReplicas(50))
+	if probed, replicas := peakToMean(multiProbe), peakToMean(replicated); probed > replicas {
+		t.Errorf("expected multi-probe peak to mean load %.3f to be at most the same as 50 replicas %.3f", probed, replicas)
+	}
+	if positions, _ := multiProbe.Snapshot(); len(positions) != 20 {
+		t.Errorf("expected a single position per key, got %d positions", len(positions))
+	}
+
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		item := multiProbe.Get(key)
+		if !bytes.Equal(multiProbe.GetByHashHint(multiProbe.HashKey(key)), item) {
+			t.Fatalf("expected GetByHashHint to probe the same hashes as Get for %q", key)
+		}
+		if items := multiProbe.GetN(key, 2); !bytes.Equal(items[0], item) {
+			t.Fatalf("expected GetN to start with %q, got %q", item, items[0])
+		}
+	}
+
+	multiProbe.Remove([]byte("node-3"))
+	if err := multiProbe.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		if item := multiProbe.GetString(fmt.Sprintf("key-%d", i)); item == "node-3" || item == "" {
+			t.Fatalf("expected a remaining node, got %q", item)
+		}
+	}
+}
+
+// peakToMean returns the load of the busiest of 20 nodes relative to the mean load, routing 100000 keys
+func peakToMean(hash *ConsistentHash) float64 {
+	nodes, keys := 20, 100000
+	for i := 0; i < nodes; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	load := make(map[string]int, nodes)
+	var peak int
+	for i := 0; i < keys; i++ {
+		item := hash.GetString(fmt.Sprintf("key-%d", i))
+		load[item]++
+		if load[item] > peak {
+			peak = load[item]
+		}
+	}
+	return float64(peak) * float64(nodes) / float64(keys)
+}
+
+func TestIncrementalBlocks(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithArrayTable()}} {
+		hash := New(append(opts, WithDefaultReplicas(10), WithBlockPartitioning(3))...)
+		present := make(map[int]bool)
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < 2000; i++ {
+			n := r.Intn(200)
+			if present[n] {
+				hash.Remove([]byte(strconv.Itoa(n)))
+			} else {
+				hash.Add([]byte(strconv.Itoa(n)))
+			}
+			present[n] = !present[n]
+		}
+
+		full := New(append(opts, WithDefaultReplicas(10), WithBlockPartitioning(3))...)
+		var keys [][]byte
+		for n := range present {
+			if present[n] {
+				keys = append(keys, []byte(strconv.Itoa(n)))
+			}
+		}
+		full.Add(keys...)
+		// the number of blocks depends on the order of changes, compare with the same number of blocks
+		full.resizeBlocks(hash.totalBlocks)
+
+		if hash.totalKeys != full.totalKeys {
+			t.Fatalf("expected %d keys, got %d", full.totalKeys, hash.totalKeys)
+		}
+		for blockNumber := uint32(0); blockNumber < hash.totalBlocks; blockNumber++ {
+			if fmt.Sprint(hash.blocks[blockNumber]) != fmt.Sprint(full.blocks[blockNumber]) {
+				t.Fatalf("expected block %d to be %v, got %v", blockNumber, full.blocks[blockNumber], hash.blocks[blockNumber])
+			}
+			if hash.values != nil && fmt.Sprintf("%q", hash.values[blockNumber]) != fmt.Sprintf("%q", full.values[blockNumber]) {
+				t.Fatalf("expected values of block %d to be %q, got %q", blockNumber, full.values[blockNumber], hash.values[blockNumber])
+			}
+		}
+	}
+}
+
+func TestMinimalMovement(t *testing.T) {
+	for _, partitioning := range []int{1, 5, 50} {
+		hash := New(WithDefaultReplicas(100), WithBlockPartitioning(partitioning))
+		nodes := 20
+		for i := 0; i < nodes; i++ {
+			hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+		}
+
+		r := rand.New(rand.NewSource(1))
+		keys := make([]string, 20000)
+		before := make([]string, len(keys))
+		for i := range keys {
+			keys[i] = fmt.Sprintf("key-%d", r.Int())
+			before[i] = hash.GetString(keys[i])
+		}
+
+		newNode := fmt.Sprintf("node-%d", nodes)
+		hash.Add([]byte(newNode))
+
+		var moved int
+		for i := range keys {
+			after := hash.GetString(keys[i])
+			if after == before[i] {
+				continue
+			}
+			if after != newNode {
+				t.Fatalf("partitioning %d: key %s moved from %s to %s instead of the new node", partitioning, keys[i], before[i], after)
+			}
+			moved++
+		}
+
+		expected := 1 / float64(nodes+1)
+		fraction := float64(moved) / float64(len(keys))
+		if fraction < expected/2 || fraction > expected*2 {
+			t.Errorf("partitioning %d: expected around %.3f of keys to move, got %.3f", partitioning, expected, fraction)
+		}
+	}
+}
+
+func TestAddContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls int
+	hash := New(WithBlockPartitioning(5), WithHashFunc(func(key []byte) uint32 {
+		calls++
+		if calls == addChunkSize+addChunkSize/2 {
+			cancel()
+		}
+		return crc32.ChecksumIEEE(key)
+	}))
+
+	keys := make([][]byte, addChunkSize*4)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("node-%d", i))
+	}
+
+	added, err := hash.AddContext(ctx, keys...)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if added != addChunkSize*2 {
+		t.Errorf("expected %d added keys, got %d", addChunkSize*2, added)
+	}
+	if err := hash.Validate(); err != nil {
+		t.Errorf("partially added ring is not valid: %v", err)
+	}
+	if hash.GetString(string(keys[0])) != string(keys[0]) {
+		t.Errorf("expected added key %s to be in the ring", keys[0])
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	hash := New(WithDefaultReplicas(3))
+	hash.Add([]byte("Bill"), []byte("Bob"), []byte("Bonny"))
+
+	positions, table := hash.Snapshot()
+	if len(positions) != 9 || len(table) != 3 {
+		t.Fatalf("expected 9 positions and 3 items, got %d and %d", len(positions), len(table))
+	}
+	if !sort.SliceIsSorted(positions, func(i, j int) bool { return positions[i] < positions[j] }) {
+		t.Errorf("expected sorted positions, got %v", positions)
+	}
+
+	for i := range positions {
+		positions[i] = 0
+	}
+	for _, value := range table {
+		value[0] = 'X'
+	}
+	table[1] = []byte("Ben")
+
+	positions, table = hash.Snapshot()
+	if len(table) != 3 || positions[0] == positions[len(positions)-1] {
+		t.Errorf("snapshot changes leaked into the ring")
+	}
+	for _, key := range []string{"Bill", "Bob", "Bonny"} {
+		if hash.GetString(key) != key {
+			t.Errorf("expected %s, got %s", key, hash.GetString(key))
+		}
+	}
+}
+
+func TestFewerKeysThanPartitioning(t *testing.T) {
+	hash := New(WithBlockPartitioning(100))
+	hash.Add([]byte("Bill"))
+	if hash.totalBlocks != 1 {
+		t.Errorf("expected 1 block, got %d", hash.totalBlocks)
+	}
+	if v := hash.GetString("Ben"); v != "Bill" {
+		t.Errorf("Asking for Ben, should have yielded Bill, got %s", v)
+	}
+	hash.Remove([]byte("Bill"))
+	if v := hash.Get([]byte("Ben")); v != nil || hash.totalBlocks != 1 {
+		t.Errorf("expected empty ring with 1 block, got %q with %d blocks", v, hash.totalBlocks)
+	}
+}
+
+func TestBlockOf(t *testing.T) {
+	for _, totalBlocks := range []uint32{0, 1, 3, 1000, 1 << 16, 1<<31 + 1, math.MaxUint32 - 1, math.MaxUint32} {
+		var previous uint32
+		for _, hash := range []uint32{0, 1, 1 << 16, 1 << 31, 1<<31 + 1, math.MaxUint32 - 1, math.MaxUint32} {
+			blockNumber := blockOf(hash, totalBlocks)
+			if totalBlocks > 0 && blockNumber >= totalBlocks || blockNumber < previous {
+				t.Fatalf("hash %d in %d blocks is in block %d after block %d", hash, totalBlocks, blockNumber, previous)
+			}
+			previous = blockNumber
+		}
+	}
+
+	// the blocks are equal, the last block doesn't get the remainder of the division
+	totalBlocks := uint32(1<<31 + 1)
+	if blockNumber := blockOf(math.MaxUint32-4, totalBlocks); blockNumber == totalBlocks-1 {
+		t.Errorf("expected hash %d not to be in the last block", uint32(math.MaxUint32-4))
+	}
+	if blockNumber := blockOf(1<<31, totalBlocks); blockNumber != 1<<30 {
+		t.Errorf("expected the middle of the circle in block %d, got %d", 1<<30, blockNumber)
+	}
+	if blockNumber := blockOf(math.MaxUint32, math.MaxUint32); blockNumber != math.MaxUint32-1 {
+		t.Errorf("expected the last hash in the last block, got %d", blockNumber)
+	}
+}
+
+func TestLookupPastBlockMax(t *testing.T) {
+	// keys are their own hash, so the positions can be placed in specific blocks
+	hash := New(WithBlockPartitioning(1), WithHashFunc(identityHash))
+	hash.Add([]byte("100"), []byte("1200000000"), []byte("3500000000"), []byte("3600000000"))
+	if hash.totalBlocks != 4 {
+		t.Fatalf("expected 4 blocks, got %d", hash.totalBlocks)
+	}
+
+	testCases := map[string]string{
+		"200":        "1200000000", // past the max of block 0
+		"1300000000": "3500000000", // past the max of block 1, block 2 is empty
+		"3550000000": "3600000000",
+		"3700000000": "100", // past the max of the last block
+	}
+	for k, v := range testCases {
+		if n := hash.GetString(k); n != v {
+			t.Errorf("Asking for %s, should have yielded %s got %s", k, v, n)
+		}
+	}
+}
+
+func TestLookupWrapsAround(t *testing.T) {
+	for _, opts := range [][]Option{{}, {WithMaxProbeBlocks(1)}} {
+		// keys are their own hash, so the first blocks are empty and the first position is in a later block
+		hash := New(append(opts, WithBlockPartitioning(1), WithHashFunc(identityHash))...)
+		hash.Add([]byte("2500000000"), []byte("2600000000"), []byte("3500000000"), []byte("3600000000"))
+
+		// the hash is bigger than every position, so it wraps to the first position every time
+		for i := 0; i < 100; i++ {
+			if n := hash.GetString("4000000000"); n != "2500000000" {
+				t.Fatalf("expected the first position 2500000000, got %s", n)
+			}
+		}
+		hash.Remove([]byte("2500000000"))
+		if n := hash.GetString("4000000000"); n != "2600000000" {
+			t.Errorf("expected the new first position 2600000000, got %s", n)
+		}
+	}
+}
+
+func TestVirtualNodeHasher(t *testing.T) {
+	combine := func(key []byte, index uint32) uint32 {
+		return fmix32(murmur32(key) ^ index)
+	}
+	hash := New(WithDefaultReplicas(5), WithMurmur32(), WithVirtualNodeHasher(combine))
+	hash.Add([]byte("Bill"), []byte("Bob"), []byte("Alice"))
+
+	positions := positionsOf(hash, "Bob")
+	expected := []uint32{murmur32([]byte("Bob"))}
+	for i := uint32(1); i < 5; i++ {
+		expected = append(expected, combine([]byte("Bob"), i))
+	}
+	sort.Slice(expected, func(i, j int) bool { return expected[i] < expected[j] })
+	if fmt.Sprint(positions) != fmt.Sprint(expected) {
+		t.Fatalf("expected the positions %v, got %v", expected, positions)
+	}
+	for _, position := range expected {
+		if item := hash.GetByHashHint(position); string(item) != "Bob" {
+			t.Errorf("expected Bob on position %d, got %q", position, item)
+		}
+	}
+
+	if !hash.Remove([]byte("Bob")) {
+		t.Fatalf("expected Bob to be removed")
+	}
+	if positions := positionsOf(hash, "Bob"); len(positions) != 0 {
+		t.Errorf("expected all the positions of Bob to be removed, got %v", positions)
+	}
+	if err := hash.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if hash.totalKeys != 10 {
+		t.Errorf("expected 10 positions left, got %d", hash.totalKeys)
+	}
+}
+
+func TestArrayTable(t *testing.T) {
+	hash := New(WithDefaultReplicas(20), WithBlockPartitioning(5))
+	arrayHash := New(WithDefaultReplicas(20), WithBlockPartitioning(5), WithArrayTable())
+	for i := 0; i < 100; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+		arrayHash.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	for i := 0; i < 100; i += 3 {
+		hash.Remove([]byte(fmt.Sprintf("node-%d", i)))
+		arrayHash.Remove([]byte(fmt.Sprintf("node-%d", i)))
+	}
+
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if hash.GetString(key) != arrayHash.GetString(key) {
+			t.Errorf("Asking for %s, array table yielded %s instead of %s", key, arrayHash.GetString(key), hash.GetString(key))
+		}
+	}
+	if arrayHash.GetString("node-1") != "node-1" {
+		t.Errorf("expected exact match for node-1, got %s", arrayHash.GetString("node-1"))
+	}
+}
+
+func TestMerge(t *testing.T) {
+	hash1 := New(WithDefaultReplicas(3))
+	hash1.Add([]byte("Bill"), []byte("Bob"))
+	hash2 := New(WithDefaultReplicas(3))
+	hash2.Add([]byte("Bonny"))
+	hash2.AddReplicas(5, []byte("Becky"))
+
+	// disjoint rings
+	hash1.Merge(hash2)
+	positions, table := hash1.Snapshot()
+	if len(table) != 4 || len(positions) != 3+3+3+5 {
+		t.Fatalf("expected 4 items with 14 positions, got %d items with %d positions", len(table), len(positions))
+	}
+	if hash1.GetString("Becky") != "Becky" || hash1.GetString("Bonny") != "Bonny" {
+		t.Errorf("expected merged keys to exist in the ring")
+	}
+
+	// overlapping rings, existing keys keep their number of replicas
+	hash3 := New(WithDefaultReplicas(10))
+	hash3.Add([]byte("Bill"), []byte("Ben"))
+	hash1.Merge(hash3)
+	positions, table = hash1.Snapshot()
+	if len(table) != 5 || len(positions) != 14+10 {
+		t.Fatalf("expected 5 items with 24 positions, got %d items with %d positions", len(table), len(positions))
+	}
+
+	// replicas of the merged keys are removed along with the key
+	hash1.Remove([]byte("Becky"))
+	hash1.Remove([]byte("Ben"))
+	positions, _ = hash1.Snapshot()
+	if len(positions) != 9 {
+		t.Errorf("expected 9 positions after removing merged keys, got %d", len(positions))
+	}
+	if err := hash1.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetN(t *testing.T) {
+	hash := New(WithDefaultReplicas(1), WithBlockPartitioning(5))
+	hash.AddReplicas(1000, []byte("heavy"))
+	hash.Add([]byte("A"), []byte("B"), []byte("C"))
+
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		items := hash.GetN(key, 4)
+		if len(items) != 4 {
+			t.Fatalf("expected 4 items for %s, got %d", key, len(items))
+		}
+		seen := make(map[string]bool)
+		for _, item := range items {
+			if seen[string(item)] {
+				t.Fatalf("duplicate item %s for %s in %q", item, key, items)
+			}
+			seen[string(item)] = true
+		}
+		if !bytes.Equal(items[0], hash.Get(key)) {
+			t.Errorf("expected first item %s to be the closest item %s", items[0], hash.Get(key))
+		}
+	}
+
+	if items := hash.GetN([]byte("key"), 10); len(items) != 4 {
+		t.Errorf("expected all 4 items when asking for more than exist, got %d", len(items))
+	}
+
+	dst := make([][]byte, 10)
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		if n := hash.GetNInto(dst[:3], key); n != 3 || fmt.Sprintf("%q", dst[:n]) != fmt.Sprintf("%q", hash.GetN(key, 3)) {
+			t.Fatalf("expected GetNInto to fill the same items as GetN for %s, got %q", key, dst[:n])
+		}
+	}
+	if n := hash.GetNInto(dst, []byte("key")); n != 4 {
+		t.Errorf("expected all 4 items when the slice is longer, got %d", n)
+	}
+	if n := hash.GetNInto(nil, []byte("key")); n != 0 {
+		t.Errorf("expected no items for an empty slice, got %d", n)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var hash *ConsistentHash
+	var logs []string
+	hash = New(WithBlockPartitioning(2), WithLogger(func(format string, args ...any) {
+		// the logger must be able to use the ring without a deadlock
+		hash.Get([]byte("Ben"))
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}))
+
+	hash.Add([]byte("Bill"), []byte("Bob"), []byte("Bonny"), []byte("Becky"))
+	hash.Add([]byte("Ben"), []byte("Bobby"), []byte("Bella"), []byte("Bert"))
+	if len(logs) == 0 {
+		t.Fatalf("expected logs for resizing blocks")
+	}
+	if !strings.Contains(logs[len(logs)-1], "resizing blocks from 1 to 4") {
+		t.Errorf("expected resizing log, got %q", logs)
+	}
+}
+
+func TestAddWeighted(t *testing.T) {
+	hash := New(WithDefaultReplicas(3), WithBlockPartitioning(2))
+	hash.AddWeighted([]WeightedKey{
+		{Key: []byte("Bill"), Replicas: 3},
+		{Key: []byte("Bob"), Replicas: 10},
+		{Key: []byte("Bonny"), Replicas: 0},
+	})
+
+	positions, table := hash.Snapshot()
+	if len(table) != 2 || len(positions) != 13 {
+		t.Fatalf("expected 2 items with 13 positions, got %d items with %d positions", len(table), len(positions))
+	}
+	hash.Remove([]byte("Bob"))
+	if positions, _ = hash.Snapshot(); len(positions) != 3 {
+		t.Errorf("expected replicas of Bob to be removed, got %d positions", len(positions))
+	}
+	if err := hash.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReweight(t *testing.T) {
+	hash := New(WithDefaultReplicas(100), WithBlockPartitioning(5))
+	hash.AddWeighted([]WeightedKey{
+		{Key: []byte("a"), Replicas: 400},
+		{Key: []byte("b"), Replicas: 100},
+		{Key: []byte("c"), Replicas: 20},
+	})
+	hash.Add([]byte("d"))
+
+	weights := map[string]uint{"a": 100, "b": 200, "c": 300, "unknown": 50}
+	hash.Reweight(weights)
+	delete(weights, "unknown")
+	weights["d"] = 100
+
+	positions, table := hash.Snapshot()
+	if len(table) != 4 {
+		t.Fatalf("expected 4 items, got %d", len(table))
+	}
+	// a few replicas might collide
+	if len(positions) < 690 || len(positions) > 700 {
+		t.Errorf("expected around 700 virtual nodes, got %d", len(positions))
+	}
+	if err := hash.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 70000; i++ {
+		counts[hash.GetString(fmt.Sprintf("key-%d", i))]++
+	}
+	for key, weight := range weights {
+		expected := int(weight) * 100
+		if counts[key] < expected/2 || counts[key] > expected*3/2 {
+			t.Errorf("expected around %d keys for %s with weight %d, got %d", expected, key, weight, counts[key])
+		}
+	}
+
+	// removing the reweighted key removes all its replicas
+	hash.Remove([]byte("c"))
+	if positions, _ = hash.Snapshot(); len(positions) > 400 {
+		t.Errorf("expected replicas of c to be removed, got %d positions", len(positions))
+	}
+}
+
+func TestLazyRebuild(t *testing.T) {
+	hash := New(WithDefaultReplicas(20), WithBlockPartitioning(2), WithLazyRebuild(10))
+	expected := New(WithDefaultReplicas(20), WithBlockPartitioning(2))
+	for i := 0; i < 100; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+		expected.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	totalBlocks := hash.totalBlocks
+
+	for i := 0; i < 99; i++ {
+		hash.Remove([]byte(fmt.Sprintf("node-%d", i)))
+		expected.Remove([]byte(fmt.Sprintf("node-%d", i)))
+		if (i+1)%10 != 0 && hash.totalBlocks != totalBlocks {
+			t.Fatalf("expected blocks to be resized after 10 removals, resized after %d", i+1)
+		}
+		totalBlocks = hash.totalBlocks
+		if err := hash.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < 100; j++ {
+			key := fmt.Sprintf("key-%d", j)
+			if hash.GetString(key) != expected.GetString(key) {
+				t.Fatalf("Asking for %s after %d removals, should have yielded %s, got %s", key, i+1, expected.GetString(key), hash.GetString(key))
+			}
+		}
+	}
+	if hash.totalBlocks == expected.totalBlocks {
+		t.Errorf("expected blocks to be stale after the last removal, got %d blocks", hash.totalBlocks)
+	}
+}
+
+func TestRebuildThreshold(t *testing.T) {
+	resizes := make(map[float64]int)
+	for _, threshold := range []float64{0.05, 0.5, 0} {
+		hash := New(WithBlockPartitioning(4), WithRebuildThreshold(threshold), WithLogger(func(format string, args ...any) {
+			if strings.HasPrefix(format, "consistenthash: resizing blocks") {
+				resizes[threshold]++
+			}
+		}))
+		for i := 0; i < 2000; i++ {
+			hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+		}
+		if err := hash.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if expected := float64(2000 / 4); threshold > 0 && math.Abs(expected-float64(hash.totalBlocks)) > threshold*float64(hash.totalBlocks) {
+			t.Errorf("expected %.0f blocks within %.2f, got %d", expected, threshold, hash.totalBlocks)
+		}
+	}
+	if resizes[0.5] >= resizes[0.05] {
+		t.Errorf("expected fewer resizes with a bigger threshold, got %v", resizes)
+	}
+}
+
+func TestWithoutBlocks(t *testing.T) {
+	withBlocks := New(WithDefaultReplicas(10), WithBlockPartitioning(2))
+	withoutBlocks := New(WithDefaultReplicas(10), WithBlockPartitioning(2), WithoutBlocks(), WithAdaptiveBlocks())
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		key := []byte(strconv.Itoa(r.Intn(200)))
+		if r.Intn(3) == 0 {
+			withBlocks.Remove(key)
+			withoutBlocks.Remove(key)
+		} else {
+			withBlocks.Add(key)
+			withoutBlocks.Add(key)
+		}
+	}
+	withoutBlocks.Prewarm()
+
+	if withBlocks.totalBlocks < 2 || withoutBlocks.totalBlocks != 1 {
+		t.Fatalf("expected many blocks and a single block, got %d and %d", withBlocks.totalBlocks, withoutBlocks.totalBlocks)
+	}
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		if !bytes.Equal(withBlocks.Get(key), withoutBlocks.Get(key)) {
+			t.Fatalf("expected the same item for %s, got %s and %s", key, withBlocks.Get(key), withoutBlocks.Get(key))
+		}
+	}
+}
+
+func TestRemoveMixedReplicas(t *testing.T) {
+	var logs []string
+	hash := New(WithDefaultReplicas(10), WithBlockPartitioning(2), WithLogger(func(format string, args ...any) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}))
+	replicas := make(map[string]uint)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		key := strconv.Itoa(r.Intn(50))
+		switch r.Intn(4) {
+		case 0:
+			hash.Remove([]byte(key))
+			delete(replicas, key)
+		case 1:
+			// the same as the default
+			hash.AddReplicas(10, []byte(key))
+			replicas[key] = 10
+		case 2:
+			n := uint(r.Intn(20) + 1)
+			hash.AddReplicas(n, []byte(key))
+			replicas[key] = n
+		default:
+			hash.Add([]byte(key))
+			replicas[key] = 10
+		}
+	}
+	if err := hash.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	var total uint
+	for _, n := range replicas {
+		total += n
+	}
+	if positions, _ := hash.Snapshot(); uint(len(positions)) != total {
+		t.Errorf("expected %d positions for %d keys, got %d", total, len(replicas), len(positions))
+	}
+	for _, l := range logs {
+		if strings.Contains(l, "were not found") {
+			t.Errorf("expected all the positions to be found on Remove, got %s", l)
+		}
+	}
+
+	// a position taken by another key is not removed
+	collide := New(WithDefaultReplicas(2), WithLogger(func(format string, args ...any) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}), WithHashFunc(func(key []byte) uint32 {
+		if len(key) > 4 {
+			// all the replicas have the same position
+			return 1
+		}
+		return crc32.ChecksumIEEE(key)
+	}))
+	collide.Add([]byte("Bill"), []byte("Bob"))
+	logs = nil
+	collide.Remove([]byte("Bob"))
+	if err := collide.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if collide.GetString("Bob") != "Bill" || len(logs) != 1 || !strings.Contains(logs[0], "1 of 2 positions") {
+		t.Errorf("expected the position of Bill to stay and the missing position to be logged, got %q", logs)
+	}
+}
+
+func TestGetExact(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithArrayTable()}} {
+		hash := New(append(opts, WithDefaultReplicas(10))...)
+		if _, exact := hash.GetExact([]byte("Bill")); exact {
+			t.Errorf("expected no exact match in an empty ring")
+		}
+		hash.Add([]byte("Bill"), []byte("Bob"), []byte("Bonny"))
+
+		if item, exact := hash.GetExact([]byte("Bob")); !exact || string(item) != "Bob" {
+			t.Errorf("expected an exact match for Bob, got %s %v", item, exact)
+		}
+		for i := 0; i < 100; i++ {
+			key := []byte(fmt.Sprintf("key-%d", i))
+			if item, exact := hash.GetExact(key); exact || !bytes.Equal(item, hash.Get(key)) {
+				t.Errorf("expected %s to be routed to %s, got %s %v", key, hash.Get(key), item, exact)
+			}
+		}
+	}
+}
+
+func TestGetExactChainedAndProbed(t *testing.T) {
+	// Bob collides with Ben
+	collide := func(key []byte) uint32 {
+		if string(key) == "Bob" {
+			key = []byte("Ben")
+		}
+		return crc32.ChecksumIEEE(key)
+	}
+	chained := New(WithHashFunc(collide), WithCollisionChaining(), WithDefaultReplicas(10))
+	chained.Add([]byte("Ben"), []byte("Bonny"))
+	if item, exact := chained.GetExact([]byte("Bob")); exact || !bytes.Equal(item, chained.Get([]byte("Bob"))) {
+		t.Errorf("expected Bob to be routed to %s, got %s %v", chained.Get([]byte("Bob")), item, exact)
+	}
+	chained.Add([]byte("Bob"))
+	for _, key := range []string{"Bob", "Ben", "Bonny"} {
+		if item, exact := chained.GetExact([]byte(key)); !exact || !bytes.Equal(item, chained.Get([]byte(key))) {
+			t.Errorf("expected an exact match for %s routed to %s, got %s %v", key, chained.Get([]byte(key)), item, exact)
+		}
+	}
+
+	probed := New(WithMultiProbe(8), WithDefaultReplicas(10))
+	probed.Add([]byte("Bill"), []byte("Bob"), []byte("Bonny"))
+	for _, key := range []string{"Bill", "Bob", "Bonny", "key-1", "key-2", "key-3"} {
+		item, exact := probed.GetExact([]byte(key))
+		if !bytes.Equal(item, probed.Get([]byte(key))) || exact != strings.HasPrefix(key, "B") {
+			t.Errorf("expected %s to be routed to %s, got %s %v", key, probed.Get([]byte(key)), item, exact)
+		}
+	}
+}
 
-	if hash1.GetString("Ben") != hash2.GetString("Ben") {
-		t.Errorf("fetching 'Ben' from both hashes should be the same")
+func TestGetCopy(t *testing.T) {
+	hash := New()
+	hash.Add([]byte("Bill"))
+
+	// changing the result of Get changes the ring
+	shared := hash.Get([]byte("key"))
+	shared[0] = 'J'
+	if item := hash.GetString("key"); item != "Jill" {
+		t.Errorf("expected Get to share the item with the ring, got %s", item)
+	}
+
+	owned := hash.GetCopy([]byte("key"))
+	owned[0] = 'B'
+	if item := hash.GetString("key"); item != "Jill" {
+		t.Errorf("expected GetCopy not to share the item with the ring, got %s", item)
+	}
+	if string(owned) != "Bill" {
+		t.Errorf("expected the copy to be changed, got %s", owned)
+	}
+	if New().GetCopy([]byte("key")) != nil {
+		t.Errorf("expected nil from an empty ring")
+	}
+}
+
+func TestMissRate(t *testing.T) {
+	hash := New(WithDefaultReplicas(10), WithBlockPartitioning(1))
+	if rate := hash.MissRate(); rate != 0 {
+		t.Errorf("expected no misses without lookups, got %f", rate)
+	}
+	hash.Add([]byte("Bill"), []byte("Bob"), []byte("Bonny"))
+	var expectedMisses int
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		h := hash.hash(key)
+		if blockNumber, _, _ := hash.lookup(h); blockNumber != blockOf(h, hash.totalBlocks) {
+			expectedMisses++
+		}
+		hash.Get(key)
+	}
+	if expectedMisses == 0 {
+		t.Fatalf("expected some lookups to miss with 1 key per block")
+	}
+	if rate := hash.MissRate(); rate != float64(expectedMisses)/1000 {
+		t.Errorf("expected miss rate %f, got %f", float64(expectedMisses)/1000, rate)
+	}
+}
+
+func TestAddAgainWithLessReplicas(t *testing.T) {
+	hash := New(WithDefaultReplicas(5))
+	hash.Add([]byte("Bill"))
+	hash.AddReplicas(10, []byte("Bob"))
+	hash.AddReplicas(2, []byte("Bill"), []byte("Bob"))
+	if positions, _ := hash.Snapshot(); len(positions) != 4 {
+		t.Errorf("expected 4 positions after adding again with 2 replicas, got %d", len(positions))
+	}
+	hash.Add([]byte("Bob"))
+	hash.Remove([]byte("Bill"))
+	if positions, _ := hash.Snapshot(); len(positions) != 5 {
+		t.Errorf("expected 5 positions of Bob, got %d", len(positions))
+	}
+	if err := hash.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHashHint(t *testing.T) {
+	hash := New(WithDefaultReplicas(20), WithBlockPartitioning(5))
+	if v := hash.GetByHashHint(hash.HashKey([]byte("Ben"))); v != nil {
+		t.Errorf("expected nil from empty ring, got %q", v)
+	}
+	hash.Add([]byte("Bill"), []byte("Bob"), []byte("Bonny"))
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		h := hash.HashKey(key)
+		if !bytes.Equal(hash.GetByHashHint(h), hash.Get(key)) {
+			t.Errorf("Asking for %s by hash, should have yielded %s, got %s", key, hash.Get(key), hash.GetByHashHint(h))
+		}
+		if fmt.Sprintf("%q", hash.GetNByHashHint(h, 2)) != fmt.Sprintf("%q", hash.GetN(key, 2)) {
+			t.Errorf("Asking for 2 items for %s by hash, should have yielded %q, got %q", key, hash.GetN(key, 2), hash.GetNByHashHint(h, 2))
+		}
+	}
+	if !bytes.Equal(hash.GetByHashHint(hash.HashKey([]byte("Bob"))), []byte("Bob")) {
+		t.Errorf("expected the exact match by hash of an item")
+	}
+}
+
+func TestVerifiedBlocks(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithShardedReadLocks(4)}} {
+		expected := New(WithDefaultReplicas(20), WithBlockPartitioning(2))
+		hash := New(append(opts, WithDefaultReplicas(20), WithBlockPartitioning(2), WithVerifiedBlocks())...)
+		for i := 0; i < 20; i++ {
+			expected.Add([]byte(fmt.Sprintf("node-%d", i)))
+			hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+		}
+
+		// move the keys of each odd block to the end of the previous block, keeping them sorted
+		for blockNumber := uint32(1); blockNumber < hash.totalBlocks; blockNumber += 2 {
+			hash.blocks[blockNumber-1] = append(hash.blocks[blockNumber-1], hash.blocks[blockNumber]...)
+			hash.blocks[blockNumber] = nil
+		}
+		if err := hash.Validate(); err == nil {
+			t.Fatalf("expected the blocks to be broken")
+		}
+
+		for i := 0; i < 10000; i++ {
+			key := fmt.Sprintf("key-%d", i)
+			if hash.GetString(key) != expected.GetString(key) {
+				t.Fatalf("Asking for %s, should have yielded %s, got %s", key, expected.GetString(key), hash.GetString(key))
+			}
+		}
+	}
+}
+
+func TestMaxVirtualNodes(t *testing.T) {
+	hash := New(WithMaxVirtualNodes(10000), WithBlockPartitioning(5))
+	for i := 0; i < 1000; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+
+	positions, table := hash.Snapshot()
+	if len(table) != 1000 {
+		t.Fatalf("expected 1000 items, got %d", len(table))
+	}
+	// a few replicas might collide
+	if len(positions) < 9900 || len(positions) > 10000 {
+		t.Errorf("expected around 10000 virtual nodes, got %d", len(positions))
+	}
+	if hash.replicas != 10 {
+		t.Errorf("expected 10 replicas per item, got %d", hash.replicas)
+	}
+
+	for i := 0; i < 500; i++ {
+		hash.Remove([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	positions, _ = hash.Snapshot()
+	if len(positions) < 9900 || len(positions) > 10000 || hash.replicas != 20 {
+		t.Errorf("expected around 10000 virtual nodes with 20 replicas, got %d with %d", len(positions), hash.replicas)
+	}
+	if err := hash.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNodesCap(t *testing.T) {
+	testCases := []struct {
+		count    int
+		replicas uint
+		expected int
+	}{
+		{0, 10, 0},
+		{10, 0, 0},
+		{10, 50, 500},
+		{1, maxPreallocNodes + 1, maxPreallocNodes},
+		{math.MaxInt, 2, maxPreallocNodes},
+		{math.MaxInt, math.MaxUint, maxPreallocNodes},
+	}
+	for _, tc := range testCases {
+		if c := nodesCap(tc.count, tc.replicas); c != tc.expected {
+			t.Errorf("nodesCap(%d, %d) should be %d, got %d", tc.count, tc.replicas, tc.expected, c)
+		}
+	}
+
+	hash := New(WithDefaultReplicas(maxPreallocNodes / 2))
+	hash.Add([]byte("Bill"), []byte("Bob"), []byte("Bonny"))
+	if positions, _ := hash.Snapshot(); len(positions) < 3*maxPreallocNodes/2-100 {
+		t.Errorf("expected around %d positions, got %d", 3*maxPreallocNodes/2, len(positions))
+	}
+}
+
+func TestWithMembers(t *testing.T) {
+	members := [][]byte{[]byte("Bill"), []byte("Bob"), []byte("Bonny"), []byte("Becky")}
+	reversed := [][]byte{[]byte("Becky"), []byte("Bonny"), []byte("Bob"), []byte("Bill")}
+	hash1 := New(WithDefaultReplicas(10), WithMembers(members...))
+	hash2 := New(WithDefaultReplicas(10), WithMembers(reversed...))
+
+	if hash1.Fingerprint() != hash2.Fingerprint() {
+		t.Errorf("expected the same fingerprint regardless of the order of members")
+	}
+	if string(reversed[0]) != "Becky" {
+		t.Errorf("expected members not to be sorted in place")
+	}
+	if hash1.GetString("Bob") != "Bob" {
+		t.Errorf("expected members to be added")
 	}
 
-	hash2.Add([]byte("Becky"))
 	hash2.Add([]byte("Ben"))
-	hash2.Add([]byte("Bobby"))
+	if hash1.Fingerprint() == hash2.Fingerprint() {
+		t.Errorf("expected different fingerprints for different members")
+	}
+}
 
-	if hash1.GetString("Bill") != hash2.GetString("Bill") ||
-		hash1.GetString("Bob") != hash2.GetString("Bob") ||
-		hash1.GetString("Bonny") != hash2.GetString("Bonny") {
-		t.Errorf("direct matches should always return the same entry")
+func TestMembershipDigest(t *testing.T) {
+	members := [][]byte{[]byte("Bill"), []byte("Bob"), []byte("Bonny")}
+	hash := New(WithDefaultReplicas(10), WithMembers(members...))
+	// different positions and internals, the same members and replicas
+	other := New(WithDefaultReplicas(5), WithMurmur32(), WithReplicaJitter(7), WithBlockPartitioning(3), WithArrayTable())
+	other.AddReplicas(10, members[2], members[0], members[1])
+
+	if hash.Fingerprint() == other.Fingerprint() {
+		t.Fatalf("expected different positions")
+	}
+	if hash.MembershipDigest() != other.MembershipDigest() {
+		t.Errorf("expected the same digest for the same members")
+	}
+
+	other.Reweight(map[string]uint{"Bob": 11})
+	if hash.MembershipDigest() == other.MembershipDigest() {
+		t.Errorf("expected a different digest for different replicas")
+	}
+	other.Reweight(map[string]uint{"Bob": 10})
+	other.Add([]byte("Ben"))
+	if hash.MembershipDigest() == other.MembershipDigest() {
+		t.Errorf("expected a different digest for different members")
+	}
+	if New().MembershipDigest() != New(WithMurmur32()).MembershipDigest() {
+		t.Errorf("expected the same digest for empty rings")
+	}
+}
+
+func TestEmptyKeys(t *testing.T) {
+	hash := New()
+	hash.Add(nil, []byte("Bill"), []byte{})
+	if _, table := hash.Snapshot(); len(table) != 1 {
+		t.Errorf("expected empty keys to be skipped, got %d items", len(table))
+	}
+	if v := hash.Get(nil); v != nil {
+		t.Errorf("expected nil for nil key, got %q", v)
+	}
+	if v := hash.Get([]byte{}); v != nil {
+		t.Errorf("expected nil for empty key, got %q", v)
+	}
+
+	hash = New(WithAllowEmptyKeys(true))
+	hash.Add(nil, []byte("Bill"))
+	hash.Add([]byte{})
+	if _, table := hash.Snapshot(); len(table) != 2 {
+		t.Errorf("expected nil and empty keys to be the same item, got %d items", len(table))
+	}
+	for _, key := range [][]byte{nil, {}} {
+		if v := hash.Get(key); v == nil || len(v) != 0 {
+			t.Errorf("expected the empty item for %q, got %q", key, v)
+		}
+	}
+	if v, found := hash.GetString2(""); !found || v != "" {
+		t.Errorf("expected the empty item to be found, got %q, %v", v, found)
+	}
+	if !hash.Remove(nil) || hash.GetString("Ben") != "Bill" {
+		t.Errorf("expected the empty item to be removed")
+	}
+
+	hash = New(WithAllowEmptyKeys(true))
+	if v, found := hash.GetString2(""); found || v != "" {
+		t.Errorf("expected nothing in empty ring, got %q, %v", v, found)
+	}
+	hash.Add([]byte{})
+	if v, found := hash.GetString2("Ben"); !found || v != "" {
+		t.Errorf("expected the only item to be the empty item, got %q, %v", v, found)
+	}
+}
+
+func TestKeyNormalizer(t *testing.T) {
+	// composes e and the combining acute accent like NFC
+	nfc := func(key string) string {
+		return strings.ReplaceAll(key, "e\u0301", "\u00e9")
+	}
+	hash := New(WithDefaultReplicas(20), WithKeyNormalizer(nfc))
+	hash.AddString("Bill", "Bob", "Bonny", "Ren\u00e9e")
+
+	if hash.GetString("Rene\u0301e") != "Ren\u00e9e" || hash.GetString("Ren\u00e9e") != "Ren\u00e9e" {
+		t.Errorf("expected both forms to route to the item")
+	}
+	for i := 0; i < 100; i++ {
+		composed, decomposed := fmt.Sprintf("caf\u00e9-%d", i), fmt.Sprintf("cafe\u0301-%d", i)
+		if hash.GetString(composed) != hash.GetString(decomposed) {
+			t.Errorf("expected %q and %q to route to the same item", composed, decomposed)
+		}
+	}
+	// []byte methods use the keys as they are
+	if hash.Remove([]byte("Rene\u0301e")) || !hash.RemoveString("Rene\u0301e") {
+		t.Errorf("expected only RemoveString to normalize the key")
+	}
+}
+
+func TestComposite(t *testing.T) {
+	hash := New(WithDefaultReplicas(10))
+	hash.Add([]byte("Bill"), []byte("Bob"), []byte("Bonny"))
+	hash.AddComposite([]byte("a"), []byte("b"))
+
+	if v := hash.GetComposite([]byte("a"), []byte("b")); string(v) != "a\x1fb" {
+		t.Errorf("expected composite key to match AddComposite, got %q", v)
+	}
+	if bytes.Equal(joinComposite([][]byte{[]byte("a"), []byte("b")}), joinComposite([][]byte{[]byte("ab")})) {
+		t.Errorf("expected parts a,b and ab to be different keys")
+	}
+	if !bytes.Equal(hash.GetComposite([]byte("Ben")), hash.Get([]byte("Ben"))) {
+		t.Errorf("expected single part composite key to be the same as the key")
+	}
+}
+
+func TestPositionCollision(t *testing.T) {
+	var logs []string
+	// the first replica of B collides with the original position of A
+	hash := New(WithDefaultReplicas(2), WithLogger(func(format string, args ...any) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}), WithHashFunc(func(key []byte) uint32 {
+		switch string(key) {
+		case "A", "B\x01\x00\x00\x00":
+			return 100
+		case "A\x01\x00\x00\x00":
+			return 200
+		case "B":
+			return 300
+		}
+		return crc32.ChecksumIEEE(key)
+	}))
+	hash.Add([]byte("A"), []byte("B"))
+
+	positions, _ := hash.Snapshot()
+	if len(positions) != 3 {
+		t.Errorf("expected 3 distinct positions, got %v", positions)
+	}
+	if !strings.Contains(strings.Join(logs, "\n"), "position 100 of \"B\" collides with \"A\"") {
+		t.Errorf("expected the collision to be logged, got %q", logs)
+	}
+
+	// removing B must not remove the position of A
+	hash.Remove([]byte("B"))
+	if hash.GetString("A") != "A" || hash.LookupTrace([]byte("A")).Position != 100 {
+		t.Errorf("expected A to keep its position")
+	}
+	hash.Remove([]byte("A"))
+	if positions, table := hash.Snapshot(); len(positions) != 0 || len(table) != 0 || !hash.IsEmpty() {
+		t.Errorf("expected empty ring, got %v %v", positions, table)
 	}
+	if err := hash.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHashCollisionReplaces(t *testing.T) {
+	// A and B have the same hash, so B replaces A
+	collide := WithHashFunc(func(key []byte) uint32 {
+		if string(key) == "A" || string(key) == "B" {
+			return 100
+		}
+		return crc32.ChecksumIEEE(key)
+	})
+	for _, batch := range []bool{false, true} {
+		var events []RingEvent
+		hash := New(WithDefaultReplicas(5), collide, WithEventBuffer(10, false))
+		if batch {
+			hash.Add([]byte("A"), []byte("B"))
+		} else {
+			hash.Add([]byte("A"))
+			hash.Add([]byte("B"))
+		}
+		if err := hash.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			if item := hash.GetString(fmt.Sprintf("key-%d", i)); item != "B" {
+				t.Fatalf("expected B to replace A, got %q", item)
+			}
+		}
+
+		hash.Remove([]byte("B"))
+		if err := hash.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if !hash.IsEmpty() || hash.Get([]byte("key")) != nil {
+			t.Errorf("expected an empty ring after removing B")
+		}
+		for len(hash.Events()) > 0 {
+			events = append(events, <-hash.Events())
+		}
+		if !batch && (len(events) != 4 || events[1].Type != EventRemoved || string(events[1].Key) != "A") {
+			t.Errorf("expected A to be reported as removed when replaced, got %v", events)
+		}
+	}
+}
+
+func TestCopyKeys(t *testing.T) {
+	for _, copyKeys := range []bool{true, false} {
+		hash := New(WithCopyKeys(copyKeys))
+		buf := []byte("Bill")
+		hash.Add(buf)
+		copy(buf, "Jack")
+
+		v := hash.GetString("Bill")
+		if copyKeys && v != "Bill" {
+			t.Errorf("expected the stored key not to change, got %s", v)
+		}
+		if !copyKeys && v != "Jack" {
+			t.Errorf("expected the stored key to share the buffer, got %s", v)
+		}
+	}
+}
+
+func TestGallop(t *testing.T) {
+	for size := 0; size < 70; size++ {
+		nodes := make([]node, size)
+		for i := range nodes {
+			nodes[i] = node{key: uint32(i*10 + 10)}
+		}
+		for hash := uint32(0); hash < uint32(size*10+20); hash++ {
+			expected := sort.Search(len(nodes), func(i int) bool { return nodes[i].key >= hash })
+			if idx := gallop(nodes, hash); idx != expected {
+				t.Fatalf("gallop in %d nodes for %d should be %d, got %d", size, hash, expected, idx)
+			}
+		}
+	}
+
+	hash := New(WithDefaultReplicas(20), WithBlockPartitioning(50))
+	gallopHash := New(WithDefaultReplicas(20), WithBlockPartitioning(50), WithGallopingSearch())
+	for i := 0; i < 100; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+		gallopHash.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if hash.GetString(key) != gallopHash.GetString(key) {
+			t.Errorf("Asking for %s, galloping search yielded %s instead of %s", key, gallopHash.GetString(key), hash.GetString(key))
+		}
+	}
+}
 
+// FuzzRing runs a sequence of operations, each two bytes: the operation and the key
+func FuzzRing(f *testing.F) {
+	f.Add([]byte{3, 2, 0, 1, 0, 2, 1, 1, 2, 5, 1, 2})
+	f.Add([]byte{0, 1, 0, 1, 0, 2, 0, 3, 1, 1, 1, 2, 1, 3, 2, 0})
+	f.Add([]byte{255, 255, 3, 7, 3, 200, 2, 9, 1, 7})
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		if len(ops) < 2 || len(ops) > 1024 {
+			// long inputs only slow down the fuzzing, as each operation validates the ring
+			return
+		}
+		hash := New(WithDefaultReplicas(uint(ops[0]%8)), WithBlockPartitioning(int(ops[1]%4)), WithAllowEmptyKeys(ops[0]&8 != 0))
+		for i := 2; i+1 < len(ops); i += 2 {
+			var key []byte
+			if ops[i+1] != 0 {
+				key = []byte(fmt.Sprintf("%d", ops[i+1]%32))
+			}
+			switch ops[i] % 5 {
+			case 0:
+				hash.Add(key)
+			case 1:
+				hash.Remove(key)
+			case 2:
+				hash.Get(key)
+			case 3:
+				hash.AddReplicas(uint(ops[i+1]), key)
+			case 4:
+				hash.GetN(key, int(ops[i+1]%4))
+			}
+			if err := hash.Validate(); err != nil {
+				t.Fatalf("after operation %d on %q: %v", ops[i], key, err)
+			}
+		}
+	})
 }
+
 func BenchmarkConcurrent(b *testing.B) { benchmarkConcurrent(b, 10000, 5, false) }
 
-func BenchmarkGet400(b *testing.B)     { benchmarkGet(b, 8, 5, false) }
-func BenchmarkGet25K(b *testing.B)     { benchmarkGet(b, 512, 5, false) }
-func BenchmarkGet50K(b *testing.B)     { benchmarkGet(b, 1024, 5, false) }
-func BenchmarkGet204K(b *testing.B)    { benchmarkGet(b, 4096, 10, false) }
-func BenchmarkGet10M(b *testing.B)     { benchmarkGet(b, 200000, 5, false) }
-func BenchmarkAdd25k(b *testing.B)     { benchmarkAdd(b, 100, 100, false) }
-func BenchmarkAddBulk25k(b *testing.B) { benchmarkBulkAdd(b, 100, 5, false) }
-func BenchmarkRemove6k(b *testing.B)   { benchmarkRemove(b, 128, 5, false) }
+func BenchmarkGet400(b *testing.B)  { benchmarkGet(b, 8, 5, false) }
+func BenchmarkGet25K(b *testing.B)  { benchmarkGet(b, 512, 5, false) }
+func BenchmarkGet50K(b *testing.B)  { benchmarkGet(b, 1024, 5, false) }
+func BenchmarkGet204K(b *testing.B) { benchmarkGet(b, 4096, 10, false) }
+func BenchmarkGet10M(b *testing.B)  { benchmarkGet(b, 200000, 5, false) }
+
+func BenchmarkGet25KArrayTable(b *testing.B)  { benchmarkGet(b, 512, 5, false, WithArrayTable()) }
+func BenchmarkGet204KArrayTable(b *testing.B) { benchmarkGet(b, 4096, 10, false, WithArrayTable()) }
+func BenchmarkAdd25k(b *testing.B)            { benchmarkAdd(b, 100, 100, false) }
+func BenchmarkAddSingle(b *testing.B)         { benchmarkAddSingle(b) }
+func BenchmarkAddBulk25k(b *testing.B)        { benchmarkBulkAdd(b, 100, 5, false) }
+func BenchmarkRemove6k(b *testing.B)          { benchmarkRemove(b, 128, 5, false) }
+
+func BenchmarkChurn(b *testing.B)     { benchmarkChurn(b, 0) }
+func BenchmarkChurnLazy(b *testing.B) { benchmarkChurn(b, 8) }
+
+func BenchmarkTrickleAdd(b *testing.B)            { benchmarkTrickleAdd(b, 0) }
+func BenchmarkTrickleAddThreshold1(b *testing.B)  { benchmarkTrickleAdd(b, 0.01) }
+func BenchmarkTrickleAddThreshold10(b *testing.B) { benchmarkTrickleAdd(b, 0.1) }
+
+func BenchmarkGetParallel(b *testing.B)          { benchmarkGetParallel(b, true) }
+func BenchmarkGetParallelUncounted(b *testing.B) { benchmarkGetParallel(b, false) }
+func BenchmarkGetParallelShardedReadLocks(b *testing.B) {
+	benchmarkGetParallel(b, true, WithShardedReadLocks(64))
+}
+
+func BenchmarkGetN3(b *testing.B)     { benchmarkGetN(b, false) }
+func BenchmarkGetNInto3(b *testing.B) { benchmarkGetN(b, true) }
 
 func BenchmarkStringGet400(b *testing.B) { benchmarkGetString(b, 8) }
 func BenchmarkStringGet25k(b *testing.B) { benchmarkGetString(b, 512) }
 
+func BenchmarkAddReplicas200(b *testing.B) { benchmarkAddWeighted(b, 200, false) }
+func BenchmarkAddWeighted200(b *testing.B) { benchmarkAddWeighted(b, 200, true) }
+
+// galloping search is faster when the hash is in the first part of the block, the crossover depends on the block size
+func BenchmarkSearchBinary64Near(b *testing.B)    { benchmarkSearch(b, 64, 16, false) }
+func BenchmarkSearchGallop64Near(b *testing.B)    { benchmarkSearch(b, 64, 16, true) }
+func BenchmarkSearchBinary64Uniform(b *testing.B) { benchmarkSearch(b, 64, 1, false) }
+func BenchmarkSearchGallop64Uniform(b *testing.B) { benchmarkSearch(b, 64, 1, true) }
+func BenchmarkSearchBinary4kNear(b *testing.B)    { benchmarkSearch(b, 4096, 16, false) }
+func BenchmarkSearchGallop4kNear(b *testing.B)    { benchmarkSearch(b, 4096, 16, true) }
+func BenchmarkSearchBinary4kUniform(b *testing.B) { benchmarkSearch(b, 4096, 1, false) }
+func BenchmarkSearchGallop4kUniform(b *testing.B) { benchmarkSearch(b, 4096, 1, true) }
+
+func BenchmarkFirstGet25k(b *testing.B)        { benchmarkFirstGet(b, 512, false) }
+func BenchmarkFirstGet25kPrewarm(b *testing.B) { benchmarkFirstGet(b, 512, true) }
+
+func benchmarkFirstGet(b *testing.B, shards int, prewarm bool) {
+	var buckets [][]byte
+	for i := 0; i < shards; i++ {
+		buckets = append(buckets, []byte(fmt.Sprintf("%d", i)))
+	}
+	lookup := []byte("shard-x-1")
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		hash := New(makeOptions(50, 5, false)...)
+		hash.Add(buckets...)
+		if prewarm {
+			hash.Prewarm()
+		}
+		b.StartTimer()
+		hash.Get(lookup)
+	}
+}
+
+func benchmarkAddWeighted(b *testing.B, shards int, weighted bool) {
+	entries := make([]WeightedKey, shards)
+	for i := range entries {
+		entries[i] = WeightedKey{Key: []byte(fmt.Sprintf("%d", i)), Replicas: uint(10 + i%5*20)}
+	}
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		hash := New(makeOptions(50, 5, false)...)
+		b.StartTimer()
+		if weighted {
+			hash.AddWeighted(entries)
+			continue
+		}
+		for _, e := range entries {
+			hash.AddReplicas(e.Replicas, e.Key)
+		}
+	}
+}
+
+// benchmarkSearch searches hashes in the first 1/nearDivision of a block with the given size
+func benchmarkSearch(b *testing.B, blockSize, nearDivision int, galloping bool) {
+	hash := New()
+	hash.gallopingSearch = galloping
+	nodes := make([]node, blockSize)
+	for i := range nodes {
+		nodes[i] = node{key: uint32(i * 1000)}
+	}
+	hashes := make([]uint32, 1024)
+	for i := range hashes {
+		hashes[i] = uint32(rand.Intn(blockSize * 1000 / nearDivision))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hash.search(nodes, hashes[i&1023])
+	}
+}
+
 func benchmarkGetString(b *testing.B, shards int) {
 
 	hash := New(WithDefaultReplicas(50))
@@ -221,6 +1694,20 @@ func benchmarkAdd(b *testing.B, shards, blockPartitionDivision int, showMetrics
 	}
 }
 
+// benchmarkAddSingle adds a single key again and again to a ring of a stable size, so only the add path allocates
+func benchmarkAddSingle(b *testing.B) {
+	hash := New(WithDefaultReplicas(20))
+	for i := 0; i < 100; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	key := []byte("node-0")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hash.Add(key)
+	}
+}
+
 func benchmarkConcurrent(b *testing.B, shards, blockPartitionDivision int, showMetrics bool) {
 	hash := New(makeOptions(50, blockPartitionDivision, showMetrics)...)
 	var lookups [][]byte
@@ -270,8 +1757,101 @@ func benchmarkRemove(b *testing.B, shards int, blockPartitionDivision int, showM
 	}
 }
 
-func benchmarkGet(b *testing.B, shards int, blockPartitionDivision int, showMetrics bool) {
-	hash := New(makeOptions(50, blockPartitionDivision, showMetrics)...)
+// benchmarkChurn removes and adds back most of the keys, which halves and doubles the number of blocks each time
+func benchmarkChurn(b *testing.B, lazyRebuild int) {
+	hash := New(WithDefaultReplicas(50), WithBlockPartitioning(5), WithLazyRebuild(lazyRebuild))
+	var buckets [][]byte
+	for i := 0; i < 4; i++ {
+		buckets = append(buckets, []byte(fmt.Sprintf("%d", i)))
+	}
+	hash.Add(buckets...)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, bucket := range buckets[1:] {
+			hash.Remove(bucket)
+		}
+		hash.Add(buckets[1:]...)
+	}
+}
+
+// benchmarkTrickleAdd adds keys one by one and reports the number of block resizes for every 1000 keys
+func benchmarkTrickleAdd(b *testing.B, threshold float64) {
+	var resizes int
+	hash := New(WithDefaultReplicas(5), WithBlockPartitioning(5), WithRebuildThreshold(threshold), WithLogger(func(format string, args ...any) {
+		if strings.HasPrefix(format, "consistenthash: resizing blocks") {
+			resizes++
+		}
+	}))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hash.Add([]byte(strconv.Itoa(i)))
+	}
+	b.ReportMetric(float64(resizes)*1000/float64(b.N), "resizes/1k")
+}
+
+// benchmarkGetParallel compares Get with the same lookup without counting the lookups and misses
+func benchmarkGetParallel(b *testing.B, counted bool, opts ...Option) {
+	hash := New(append([]Option{WithDefaultReplicas(50), WithBlockPartitioning(5)}, opts...)...)
+	var lookups [][]byte
+	for i := 0; i < 512; i++ {
+		hash.Add([]byte(fmt.Sprintf("%d", i)))
+		lookups = append(lookups, []byte(fmt.Sprintf("shard-x-%d", i)))
+	}
+
+	// same as Get without the counters
+	get := func(key []byte) []byte {
+		if hash.IsEmpty() || len(key) == 0 {
+			return nil
+		}
+		h := hash.hash(key)
+		hash.mu.RLock()
+		defer hash.mu.RUnlock()
+		if v, ok := hash.hashMap[h]; ok {
+			return v
+		}
+		if blockNumber, idx, ok := hash.lookup(h); ok {
+			return hash.valueOf(blockNumber, idx)
+		}
+		return nil
+	}
+	if counted {
+		get = hash.Get
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			i++
+			get(lookups[i&511])
+		}
+	})
+}
+
+func benchmarkGetN(b *testing.B, into bool) {
+	hash := New(WithDefaultReplicas(50), WithBlockPartitioning(5))
+	var lookups [][]byte
+	for i := 0; i < 512; i++ {
+		hash.Add([]byte(fmt.Sprintf("%d", i)))
+		lookups = append(lookups, []byte(fmt.Sprintf("shard-x-%d", i)))
+	}
+	dst := make([][]byte, 3)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if into {
+			hash.GetNInto(dst, lookups[i&511])
+		} else {
+			hash.GetN(lookups[i&511], 3)
+		}
+	}
+}
+
+func benchmarkGet(b *testing.B, shards int, blockPartitionDivision int, showMetrics bool, opts ...Option) {
+	hash := New(append(makeOptions(50, blockPartitionDivision, showMetrics), opts...)...)
 	var lookups [][]byte
 	var buckets [][]byte
 	for i := 0; i <= shards; i++ {
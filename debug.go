@@ -0,0 +1,106 @@
+package consistenthash
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+)
+
+// maxDOTNodes maximum number of virtual nodes drawn by ExportDOT
+const maxDOTNodes = 1000
+
+// LookupTraceResult intermediate values of looking up a key in the hash ring
+type LookupTraceResult struct {
+	Hash          uint32 // hash of the key
+	TotalBlocks   uint32 // number of blocks in the circle
+	BlockSize     uint32 // size of each block in the circle
+	BlockNumber   uint32 // block number calculated from the hash
+	BlockKeys     int    // number of keys in the calculated block
+	ResolvedBlock uint32 // block that has the closest key
+	ResolvedIndex int    // index of the closest key in the resolved block
+	Position      uint32 // position of the closest key in the circle
+	Found         bool   // false if the hash ring is empty
+	Value         []byte // the closest item, same as Get
+}
+
+// LookupTrace looks up the key the same way as Get and returns the intermediate values for debugging
+func (ch *ConsistentHash) LookupTrace(key []byte) LookupTraceResult {
+	hash, ok := ch.hashSafely(key)
+	if !ok {
+		return LookupTraceResult{}
+	}
+
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	trace := LookupTraceResult{
+		Hash:        hash,
+		TotalBlocks: ch.totalBlocks,
+		BlockSize:   math.MaxUint32 / ch.totalBlocks,
+		BlockNumber: ch.blockNumberOf(hash, ch.totalBlocks),
+	}
+	trace.BlockKeys = len(ch.blocks[trace.BlockNumber])
+	trace.ResolvedBlock, trace.ResolvedIndex, trace.Found = ch.lookup(hash)
+	if trace.Found {
+		trace.Position = ch.blocks[trace.ResolvedBlock][trace.ResolvedIndex].key
+		trace.Value = ch.valueOf(trace.ResolvedBlock, trace.ResolvedIndex)
+	}
+	return trace
+}
+
+// EmptyBlocks returns the numbers of the blocks without any key, lookups falling in them continue to the next blocks
+// many empty blocks mean the block partitioning is too small for how the keys are spread in the circle
+func (ch *ConsistentHash) EmptyBlocks() []uint32 {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	var empty []uint32
+	for blockNumber := uint32(0); blockNumber < ch.totalBlocks; blockNumber++ {
+		if len(ch.blocks[blockNumber]) == 0 {
+			empty = append(empty, blockNumber)
+		}
+	}
+	return empty
+}
+
+// ExportDOT writes the hash ring as a Graphviz DOT graph, virtual nodes are drawn clockwise in a circle
+// each node is labeled by the owning item and its position, rings with more than maxDOTNodes are sampled evenly
+func (ch *ConsistentHash) ExportDOT(w io.Writer) error {
+	type dotNode struct {
+		position uint32
+		value    []byte
+	}
+
+	ch.mu.RLock()
+	nodes := make([]dotNode, 0, ch.totalKeys)
+	for blockNumber := uint32(0); blockNumber < ch.totalBlocks; blockNumber++ {
+		for _, n := range ch.blocks[blockNumber] {
+			nodes = append(nodes, dotNode{n.key, ch.hashMap[n.pointer]})
+		}
+	}
+	ch.mu.RUnlock()
+
+	step := 1
+	if len(nodes) > maxDOTNodes {
+		step = (len(nodes) + maxDOTNodes - 1) / maxDOTNodes
+	}
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, "digraph ring {")
+	fmt.Fprintln(b, "\tlayout=circo;")
+	fmt.Fprintln(b, "\tnode [shape=box];")
+	if step > 1 {
+		fmt.Fprintf(b, "\tlabel=%q;\n", fmt.Sprintf("showing every %d of %d virtual nodes", step, len(nodes)))
+	}
+	var drawn int
+	for i := 0; i < len(nodes); i += step {
+		fmt.Fprintf(b, "\tn%d [label=%q];\n", drawn, fmt.Sprintf("%s\n%d", nodes[i].value, nodes[i].position))
+		drawn++
+	}
+	for i := 0; i < drawn; i++ {
+		fmt.Fprintf(b, "\tn%d -> n%d;\n", i, (i+1)%drawn)
+	}
+	fmt.Fprintln(b, "}")
+	return b.Flush()
+}
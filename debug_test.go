@@ -0,0 +1,95 @@
+package consistenthash
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestLookupTrace(t *testing.T) {
+	hash := New(WithDefaultReplicas(10), WithBlockPartitioning(3))
+	for i := 0; i < 50; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		trace := hash.LookupTrace(key)
+		if !trace.Found {
+			t.Fatalf("expected %s to be found", key)
+		}
+		if expected := trace.Hash / trace.BlockSize; expected < trace.TotalBlocks && expected != trace.BlockNumber {
+			t.Errorf("expected block %d for hash %d, got %d", expected, trace.Hash, trace.BlockNumber)
+		}
+		if trace.Position < trace.Hash && trace.ResolvedBlock >= trace.BlockNumber {
+			t.Errorf("position %d is counter-clockwise of hash %d", trace.Position, trace.Hash)
+		}
+		if !bytes.Equal(trace.Value, hash.Get(key)) {
+			t.Errorf("expected traced value %s to be %s", trace.Value, hash.Get(key))
+		}
+	}
+}
+
+func TestExportDOT(t *testing.T) {
+	testCases := map[int]int{
+		10:   30,   // 10 keys with 3 replicas
+		1000: 1000, // 3000 virtual nodes sampled every 3rd
+	}
+	for keys, expected := range testCases {
+		hash := New(WithDefaultReplicas(3))
+		for i := 0; i < keys; i++ {
+			hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+		}
+
+		var b bytes.Buffer
+		if err := hash.ExportDOT(&b); err != nil {
+			t.Fatal(err)
+		}
+		out := b.String()
+		if !strings.HasPrefix(out, "digraph ring {\n") || !strings.HasSuffix(out, "}\n") {
+			t.Fatalf("invalid DOT graph %q", out)
+		}
+		nodes := regexp.MustCompile(`(?m)^\tn\d+ \[label=".*"\];$`).FindAllString(out, -1)
+		edges := regexp.MustCompile(`(?m)^\tn\d+ -> n\d+;$`).FindAllString(out, -1)
+		if len(nodes) != expected || len(edges) != expected {
+			t.Errorf("expected %d nodes and edges, got %d nodes and %d edges", expected, len(nodes), len(edges))
+		}
+		if lines := strings.Count(out, "\n"); lines != len(nodes)+len(edges)+strings.Count(out, "\tlabel=")+4 {
+			t.Errorf("unexpected lines in DOT graph %q", out)
+		}
+	}
+}
+
+func TestEmptyBlocks(t *testing.T) {
+	// all the keys are in the first quarter of the circle, so the other blocks are empty
+	hash := New(WithBlockPartitioning(1), WithHashFunc(func(key []byte) uint32 {
+		return murmur32(key) >> 2
+	}))
+	for i := 0; i < 64; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+
+	empty := hash.EmptyBlocks()
+	var expected []uint32
+	hash.mu.RLock()
+	for blockNumber, nodes := range hash.blocks {
+		if len(nodes) == 0 {
+			expected = append(expected, uint32(blockNumber))
+		}
+	}
+	totalBlocks := hash.totalBlocks
+	hash.mu.RUnlock()
+	if !reflect.DeepEqual(empty, expected) {
+		t.Errorf("expected empty blocks %v, got %v", expected, empty)
+	}
+	if len(empty) < int(totalBlocks)*3/4 {
+		t.Errorf("expected at least 3/4 of %d blocks to be empty, got %d", totalBlocks, len(empty))
+	}
+
+	if empty := New().EmptyBlocks(); !reflect.DeepEqual(empty, []uint32{0}) {
+		t.Errorf("expected the only block of an empty ring to be empty, got %v", empty)
+	}
+}
@@ -0,0 +1,93 @@
+package consistenthash
+
+import (
+	"bytes"
+	"time"
+)
+
+// maxDrainSteps maximum number of times the replicas of a draining key are reduced
+const maxDrainSteps = 100
+
+// DrainNode reduces the replicas of the key to zero in steps over the given duration, then removes it
+// it returns false if the key doesn't exist, draining stops if the key is removed meanwhile or the ring is closed
+// the key is removed at once if the duration is too short to wait between the steps
+func (ch *ConsistentHash) DrainNode(key []byte, d time.Duration) bool {
+	hash := ch.hash(key)
+
+	ch.lock()
+	originalHash, existing, ok := ch.identifyHash(hash, key)
+	ok = ok && bytes.Equal(existing, key)
+	replicas := ch.replicasOf(originalHash)
+	if ok {
+		// kept explicitly, so scaling the default replicas (WithMaxVirtualNodes) doesn't change the draining key
+		ch.replicaMap[originalHash] = replicas
+	}
+	ch.unlock()
+	if !ok {
+		return false
+	}
+
+	steps := replicas
+	if steps > maxDrainSteps {
+		steps = maxDrainSteps
+	}
+	interval := d / time.Duration(steps)
+	if interval <= 0 {
+		// too short to drain in steps
+		return ch.Remove(key)
+	}
+	ch.drains.Add(1)
+	go func() {
+		defer ch.drains.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		current := replicas
+		for step := uint(1); ; step++ {
+			select {
+			case <-ch.closed:
+				return
+			case <-ticker.C:
+			}
+			// in 64 bits, so it doesn't overflow on 32-bit platforms
+			next := replicas - uint(uint64(replicas)*uint64(step)/uint64(steps))
+			if step == steps {
+				// the last replica is removed with the key
+				next = current
+			}
+			if !ch.reduceReplicas(originalHash, key, current, next) {
+				return
+			}
+			if step == steps {
+				ch.Remove(key)
+				return
+			}
+			current = next
+		}
+	}()
+	return true
+}
+
+// Close stops draining the keys and waits for the draining goroutines to return
+func (ch *ConsistentHash) Close() {
+	ch.closeOnce.Do(func() {
+		close(ch.closed)
+	})
+	ch.drains.Wait()
+}
+
+// reduceReplicas reduces the number of replicas of an existing key, returns false if the key doesn't exist
+// or its number of replicas is not the expected one, as it's removed or changed meanwhile
+func (ch *ConsistentHash) reduceReplicas(originalHash uint32, key []byte, expected, replicas uint) bool {
+	ch.lock()
+	defer ch.unlock()
+	if existing, ok := ch.hashMap[originalHash]; !ok || !bytes.Equal(existing, key) || ch.replicasOf(originalHash) != expected {
+		return false
+	}
+	if replicas < expected {
+		// storeKey removes the extra replicas
+		ch.storeKey(originalHash, key, replicas)
+		ch.replicaMap[originalHash] = replicas
+		ch.balanceBlocks(ch.totalKeys / ch.blockPartitioning)
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package consistenthash
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDrainNode(t *testing.T) {
+	hash := New(WithDefaultReplicas(20))
+	defer hash.Close()
+	hash.Add([]byte("Bill"), []byte("Bob"))
+	if hash.DrainNode([]byte("Ben"), time.Millisecond) {
+		t.Errorf("expected draining a missing key to fail")
+	}
+	if !hash.DrainNode([]byte("Bob"), 100*time.Millisecond) {
+		t.Fatalf("expected draining Bob to start")
+	}
+
+	previous := 40
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		positions, table := hash.Snapshot()
+		if len(positions) > previous {
+			t.Fatalf("expected the positions to decrease, got %d after %d", len(positions), previous)
+		}
+		previous = len(positions)
+		if len(table) == 1 {
+			break
+		}
+	}
+	if v := hash.GetString("Ben"); v != "Bill" || previous != 20 {
+		t.Errorf("expected Bob to be removed, got %s with %d positions", v, previous)
+	}
+	if err := hash.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDrainNodeStops(t *testing.T) {
+	hash := New(WithDefaultReplicas(20))
+	hash.Add([]byte("Bill"), []byte("Bob"), []byte("Bonny"))
+	hash.DrainNode([]byte("Bob"), time.Hour)
+	hash.DrainNode([]byte("Bonny"), 200*time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	hash.Remove([]byte("Bonny"))
+	hash.AddReplicas(5, []byte("Bonny"))
+
+	// Bonny is removed and added again meanwhile, so draining it stops
+	time.Sleep(50 * time.Millisecond)
+	if positions, table := hash.Snapshot(); len(table) != 3 || len(positions) != 45 {
+		t.Errorf("expected all the items with 45 positions, got %d items with %d positions", len(table), len(positions))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		hash.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected Close to stop draining")
+	}
+	if positions, _ := hash.Snapshot(); len(positions) != 45 {
+		t.Errorf("expected draining to stop, got %d positions", len(positions))
+	}
+}
+
+func TestDrainNodeWithoutDuration(t *testing.T) {
+	hash := New(WithDefaultReplicas(20))
+	hash.Add([]byte("Bill"), []byte("Bob"), []byte("Bonny"))
+	if !hash.DrainNode([]byte("Bob"), 0) || !hash.DrainNode([]byte("Bonny"), time.Nanosecond) {
+		t.Fatalf("expected the keys to be drained")
+	}
+	// removed at once instead of panicking in the draining goroutine
+	if positions, table := hash.Snapshot(); len(table) != 1 || len(positions) != 20 {
+		t.Errorf("expected only Bill with 20 positions, got %d items with %d positions", len(table), len(positions))
+	}
+	if hash.DrainNode([]byte("Bob"), 0) {
+		t.Errorf("expected false for a removed key")
+	}
+	hash.Close()
+}
+
+func TestDrainNodeScaledReplicas(t *testing.T) {
+	hash := New(WithMaxVirtualNodes(60))
+	defer hash.Close()
+	hash.Add([]byte("Bill"), []byte("Bob"), []byte("Bonny"))
+	if !hash.DrainNode([]byte("Bob"), 50*time.Millisecond) {
+		t.Fatalf("expected draining Bob to start")
+	}
+	// scaling the default replicas doesn't stop draining
+	hash.Add([]byte("Becky"))
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if _, table := hash.Snapshot(); len(table) == 3 {
+			return
+		}
+	}
+	t.Errorf("expected Bob to be drained")
+}
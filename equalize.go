@@ -0,0 +1,107 @@
+package consistenthash
+
+// equalizeTolerance relative distance from the mean share an item may have before its replicas are nudged
+const equalizeTolerance = 0.1
+
+// EqualizeArcs tightens the distribution of the circle between the items by nudging the number of replicas
+// of each item owning significantly more or less than the mean share down or up, over the given number of passes
+// all items are treated as equal weight, so weights given by AddReplicas are overridden for the nudged items
+// a pass that doesn't lower the variance of the shares or exceeds the capacity (WithCapacity) is reverted and stops the passes
+func (ch *ConsistentHash) EqualizeArcs(iterations int) {
+	ch.lock()
+	defer ch.unlock()
+
+	if len(ch.hashMap) < 2 || ch.multiProbe > 0 {
+		return
+	}
+	owned := ch.ownedArcs()
+	variance := ch.shareVariance(owned)
+	for i := 0; i < iterations; i++ {
+		previous := make(map[uint32]uint, len(ch.hashMap))
+		var growth int
+		mean := float64(ch.ringSize) / float64(len(ch.hashMap))
+		for originalHash := range ch.hashMap {
+			replicas := ch.replicasOf(originalHash)
+			ratio := float64(owned[originalHash]) / mean
+			if ratio > 1-equalizeTolerance && ratio < 1+equalizeTolerance {
+				continue
+			}
+			// move halfway to the number of replicas expected to own the mean share, by at least one
+			target := float64(replicas) / ratio
+			if ratio == 0 {
+				target = float64(replicas) * 2
+			}
+			nudged := ch.nudgeReplicas(replicas, (target-float64(replicas))/2)
+			if nudged == replicas {
+				continue
+			}
+			previous[originalHash] = replicas
+			growth += int(nudged) - int(replicas)
+			ch.setReplicas(originalHash, nudged)
+		}
+		if len(previous) == 0 {
+			break
+		}
+		if !ch.fits(growth) {
+			for originalHash, replicas := range previous {
+				ch.setReplicas(originalHash, replicas)
+			}
+			break
+		}
+		ch.rebuild()
+
+		nudgedOwned := ch.ownedArcs()
+		if nudgedVariance := ch.shareVariance(nudgedOwned); nudgedVariance < variance {
+			owned, variance = nudgedOwned, nudgedVariance
+			continue
+		}
+		for originalHash, replicas := range previous {
+			ch.setReplicas(originalHash, replicas)
+		}
+		ch.rebuild()
+		break
+	}
+	ch.logf("consistenthash: equalized arcs of %d items to share variance %g", len(ch.hashMap), variance)
+}
+
+// nudgeReplicas returns the number of replicas moved by delta, by at least one and to at least one replica
+func (ch *ConsistentHash) nudgeReplicas(replicas uint, delta float64) uint {
+	switch {
+	case delta > -1 && delta < 0:
+		delta = -1
+	case delta >= 0 && delta < 1:
+		delta = 1
+	}
+	nudged := float64(replicas) + delta
+	if nudged < 1 {
+		return 1
+	}
+	if nudged > maxReplicas {
+		return ch.clampReplicasLocked(maxReplicas)
+	}
+	return ch.clampReplicasLocked(uint(nudged))
+}
+
+// setReplicas stores the number of replicas of the original hash, the write lock must be held
+func (ch *ConsistentHash) setReplicas(originalHash uint32, replicas uint) {
+	// do not store number of replicas if uses default number
+	if replicas == ch.replicas {
+		delete(ch.replicaMap, originalHash)
+	} else {
+		ch.replicaMap[originalHash] = replicas
+	}
+}
+
+// shareVariance returns the variance of the shares of the circle owned by the items
+func (ch *ConsistentHash) shareVariance(owned map[uint32]uint64) float64 {
+	if len(ch.hashMap) == 0 {
+		return 0
+	}
+	mean := 1 / float64(len(ch.hashMap))
+	var sum float64
+	for originalHash := range ch.hashMap {
+		diff := float64(owned[originalHash])/float64(ch.ringSize) - mean
+		sum += diff * diff
+	}
+	return sum / float64(len(ch.hashMap))
+}
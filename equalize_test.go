@@ -0,0 +1,51 @@
+package consistenthash
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEqualizeArcs(t *testing.T) {
+	hash := New(WithDefaultReplicas(10))
+	for i := 0; i < 50; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	before := arcVariance(hash)
+	hash.EqualizeArcs(10)
+	after := arcVariance(hash)
+	if after >= before {
+		t.Fatalf("expected the variance of the arc coverage to decrease from %g, got %g", before, after)
+	}
+	if err := hash.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		if hash.Get([]byte(fmt.Sprintf("node-%d", i))) == nil {
+			t.Fatalf("expected node-%d to stay in the ring", i)
+		}
+	}
+
+	// nothing to equalize with a single item
+	single := New()
+	single.Add([]byte("only"))
+	single.EqualizeArcs(10)
+	if got := string(single.Get([]byte("key"))); got != "only" {
+		t.Errorf("expected the only item, got %q", got)
+	}
+}
+
+// arcVariance returns the variance of the shares of the circle from the ownership arcs of the items
+func arcVariance(hash *ConsistentHash) float64 {
+	arcs := hash.OwnershipArcs()
+	mean := 1 / float64(len(arcs))
+	var sum float64
+	for _, itemArcs := range arcs {
+		var owned uint64
+		for _, arc := range itemArcs {
+			owned += arc[1] - arc[0]
+		}
+		diff := float64(owned)/float64(ringSize) - mean
+		sum += diff * diff
+	}
+	return sum / float64(len(arcs))
+}
@@ -0,0 +1,82 @@
+package consistenthash
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrEmptyRing is returned when the ring has no items to route to or remove from
+	ErrEmptyRing = errors.New("consistenthash: empty ring")
+	// ErrInvalidReplicas is returned when a key is added with less than 1 replica
+	ErrInvalidReplicas = errors.New("consistenthash: invalid number of replicas")
+	// ErrKeyNotFound is returned when the key to remove is not in the ring
+	ErrKeyNotFound = errors.New("consistenthash: key not found")
+	// ErrEmptyKey is returned when an empty key is given without WithAllowEmptyKeys
+	ErrEmptyKey = errors.New("consistenthash: empty key")
+	// ErrHashPanicked is returned when the hash function panics on the key with WithRecoverHashPanics
+	ErrHashPanicked = errors.New("consistenthash: hash function panicked")
+)
+
+// TryAddReplicas is the same as AddReplicas, but returns ErrInvalidReplicas instead of ignoring the keys
+// if the number of replicas is less than 1, ErrEmptyKey or ErrHashPanicked instead of skipping a key
+// and ErrCapacityExceeded if the keys exceed the capacity
+func (ch *ConsistentHash) TryAddReplicas(replicas uint, keys ...[]byte) error {
+	if replicas < 1 {
+		return ErrInvalidReplicas
+	}
+	if err := ch.checkKeys(keys); err != nil {
+		return err
+	}
+	return ch.add(ch.clampReplicas(replicas), false, ch.filterKeys(keys)...)
+}
+
+// TryRemove is the same as Remove, but returns ErrEmptyRing if the ring has no items
+// and ErrKeyNotFound if the key is not in the ring
+func (ch *ConsistentHash) TryRemove(key []byte) error {
+	if !ch.allowEmptyKeys && len(key) == 0 {
+		return ErrEmptyKey
+	}
+	if ch.IsEmpty() {
+		return ErrEmptyRing
+	}
+	if !ch.Remove(key) {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// TryGet is the same as Get, but returns ErrEmptyRing instead of nil if the ring has no items,
+// ErrEmptyKey for an empty key and ErrHashPanicked if the hash function panics on the key (WithRecoverHashPanics)
+func (ch *ConsistentHash) TryGet(key []byte) ([]byte, error) {
+	if !ch.allowEmptyKeys && len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+	if ch.latencies != nil {
+		defer ch.latencies.since(time.Now())
+	}
+	hash, ok := ch.hashSafely(key)
+	if !ok {
+		return nil, ErrHashPanicked
+	}
+	item := ch.GetByHashHint(hash)
+	if item == nil {
+		if ch.IsEmpty() {
+			return nil, ErrEmptyRing
+		}
+	}
+	return item, nil
+}
+
+// checkKeys returns the error of the first key which would be skipped by adding the keys
+func (ch *ConsistentHash) checkKeys(keys [][]byte) error {
+	for _, key := range keys {
+		if !ch.allowEmptyKeys && len(key) == 0 {
+			return ErrEmptyKey
+		}
+		if !ch.acceptKey(key) {
+			return ErrHashPanicked
+		}
+	}
+	return nil
+}
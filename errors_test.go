@@ -0,0 +1,76 @@
+package consistenthash
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTryErrors(t *testing.T) {
+	hash := New()
+	if _, err := hash.TryGet([]byte("key")); !errors.Is(err, ErrEmptyRing) {
+		t.Errorf("expected ErrEmptyRing from TryGet, got %v", err)
+	}
+	if err := hash.TryRemove([]byte("Bill")); !errors.Is(err, ErrEmptyRing) {
+		t.Errorf("expected ErrEmptyRing from TryRemove, got %v", err)
+	}
+	if err := hash.TryAddReplicas(0, []byte("Bill")); !errors.Is(err, ErrInvalidReplicas) {
+		t.Errorf("expected ErrInvalidReplicas from TryAddReplicas, got %v", err)
+	}
+	if !hash.IsEmpty() {
+		t.Errorf("expected no items after invalid replicas")
+	}
+
+	if err := hash.TryAdd([]byte("Bill")); err != nil {
+		t.Fatalf("expected no error from TryAdd, got %v", err)
+	}
+	if err := hash.TryAddReplicas(3, []byte("Bob")); err != nil {
+		t.Fatalf("expected no error from TryAddReplicas, got %v", err)
+	}
+	if item, err := hash.TryGet([]byte("key")); err != nil || item == nil {
+		t.Errorf("expected an item from TryGet, got %q, %v", item, err)
+	}
+	if _, err := hash.TryGet(nil); !errors.Is(err, ErrEmptyKey) {
+		t.Errorf("expected ErrEmptyKey from TryGet, got %v", err)
+	}
+	if err := hash.TryRemove([]byte("Alice")); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound from TryRemove, got %v", err)
+	}
+	if err := hash.TryRemove(nil); !errors.Is(err, ErrEmptyKey) {
+		t.Errorf("expected ErrEmptyKey from TryRemove, got %v", err)
+	}
+	if err := hash.TryRemove([]byte("Bill")); err != nil {
+		t.Errorf("expected no error from TryRemove, got %v", err)
+	}
+	if err := hash.TryRemove([]byte("Bill")); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound from TryRemove of a removed key, got %v", err)
+	}
+
+	capped := New(WithCapacity(5))
+	if err := capped.TryAddReplicas(10, []byte("Bill")); !errors.Is(err, ErrCapacityExceeded) {
+		t.Errorf("expected ErrCapacityExceeded from TryAddReplicas, got %v", err)
+	}
+}
+
+func TestTryErrorsSkippedKeys(t *testing.T) {
+	hash := New(WithRecoverHashPanics(), WithHashFunc(panickingHash))
+	if err := hash.TryAdd([]byte("Bill"), nil); !errors.Is(err, ErrEmptyKey) {
+		t.Errorf("expected ErrEmptyKey from TryAdd, got %v", err)
+	}
+	if err := hash.TryAddReplicas(3, []byte("Bill"), []byte{}); !errors.Is(err, ErrEmptyKey) {
+		t.Errorf("expected ErrEmptyKey from TryAddReplicas, got %v", err)
+	}
+	if err := hash.TryAdd([]byte("Bill"), []byte("bad-1")); !errors.Is(err, ErrHashPanicked) {
+		t.Errorf("expected ErrHashPanicked from TryAdd, got %v", err)
+	}
+	if !hash.IsEmpty() {
+		t.Errorf("expected no keys to be added")
+	}
+
+	hash.Add([]byte("Bill"), nil, []byte("bad-1"))
+	if _, err := hash.TryGet([]byte("bad-key")); !errors.Is(err, ErrHashPanicked) {
+		t.Errorf("expected ErrHashPanicked from TryGet, got %v", err)
+	}
+	if item, err := hash.TryGet([]byte("key")); err != nil || string(item) != "Bill" {
+		t.Errorf("expected Bill from TryGet, got %q, %v", item, err)
+	}
+}
@@ -0,0 +1,51 @@
+package consistenthash
+
+// EventType type of the change in the ring
+type EventType int
+
+const (
+	// EventAdded a new item is added to the ring
+	EventAdded EventType = iota + 1
+	// EventRemoved an item is removed from the ring
+	EventRemoved
+)
+
+// RingEvent a change of the items in the ring
+type RingEvent struct {
+	Type EventType
+	Key  []byte
+}
+
+// Events returns the channel of the changes of the items in the ring, only WithEventBuffer, otherwise it's nil
+// events are sent after releasing the lock and dropped if the channel is full, unless WithEventBuffer is set to block
+func (ch *ConsistentHash) Events() <-chan RingEvent {
+	return ch.events
+}
+
+// emit collects an event to be sent after releasing the lock and keeps it in the history, the write lock must be held
+func (ch *ConsistentHash) emit(eventType EventType, key []byte) {
+	if ch.muted {
+		return
+	}
+	if ch.historySize > 0 {
+		ch.record(eventType, key)
+	}
+	if ch.events != nil {
+		ch.pending = append(ch.pending, RingEvent{Type: eventType, Key: key})
+	}
+}
+
+// sendEvents sends the events, they are dropped if the channel is full unless blocking (WithEventBuffer)
+// the lock must not be held
+func (ch *ConsistentHash) sendEvents(events []RingEvent) {
+	for _, event := range events {
+		if ch.blockOnEvents {
+			ch.events <- event
+			continue
+		}
+		select {
+		case ch.events <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package consistenthash
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEvents(t *testing.T) {
+	if New().Events() != nil {
+		t.Errorf("expected no events without WithEventBuffer")
+	}
+
+	hash := New(WithEventBuffer(10, false))
+	hash.Add([]byte("Bill"), []byte("Bob"))
+	hash.Add([]byte("Bill"))
+	hash.Remove([]byte("Bill"))
+	hash.Remove([]byte("Ben"))
+	hash.AddWeighted([]WeightedKey{{Key: []byte("Bonny"), Replicas: 5}})
+
+	expected := []RingEvent{
+		{EventAdded, []byte("Bill")},
+		{EventAdded, []byte("Bob")},
+		{EventRemoved, []byte("Bill")},
+		{EventAdded, []byte("Bonny")},
+	}
+	for _, e := range expected {
+		if event := <-hash.Events(); event.Type != e.Type || string(event.Key) != string(e.Key) {
+			t.Errorf("expected event %d for %s, got %d for %s", e.Type, e.Key, event.Type, event.Key)
+		}
+	}
+	select {
+	case event := <-hash.Events():
+		t.Errorf("expected no more events, got %d for %s", event.Type, event.Key)
+	default:
+	}
+}
+
+func TestEventsFullBuffer(t *testing.T) {
+	hash := New(WithEventBuffer(2, false))
+	for i := 0; i < 10; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	if len(hash.Events()) != 2 {
+		t.Errorf("expected 2 events in the buffer, got %d", len(hash.Events()))
+	}
+	if event := <-hash.Events(); string(event.Key) != "node-0" {
+		t.Errorf("expected the first event to be kept, got %s", event.Key)
+	}
+}
+
+func TestEventsBlocking(t *testing.T) {
+	hash := New(WithEventBuffer(2, true))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		if event := <-hash.Events(); string(event.Key) != fmt.Sprintf("node-%d", i) {
+			t.Errorf("expected the event of node-%d, got %s", i, event.Key)
+		}
+		// the ring is not locked while waiting for the events to be received
+		hash.Get([]byte("key"))
+	}
+	<-done
+}
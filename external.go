@@ -0,0 +1,14 @@
+package consistenthash
+
+// AddByIndex adds the values at the given indices of the values given to WithExternalValues, Get returns
+// the same slice as the value, so its memory is shared instead of copied, indices out of range are ignored
+// the values are the keys, so they are hashed and removed like keys added by Add
+func (ch *ConsistentHash) AddByIndex(indices ...int) {
+	keys := make([][]byte, 0, len(indices))
+	for _, i := range indices {
+		if i >= 0 && i < len(ch.externalValues) {
+			keys = append(keys, ch.externalValues[i])
+		}
+	}
+	_ = ch.tryAdd(true, keys)
+}
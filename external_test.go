@@ -0,0 +1,76 @@
+package consistenthash
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// largeValues makes values of the given size, like connection strings much longer than the node names
+func largeValues(n, size int) [][]byte {
+	values := make([][]byte, n)
+	for i := range values {
+		values[i] = append([]byte(fmt.Sprintf("node-%d:", i)), bytes.Repeat([]byte("x"), size)...)
+	}
+	return values
+}
+
+func TestAddByIndex(t *testing.T) {
+	values := largeValues(10, 100)
+	hash := New(WithExternalValues(values), WithDefaultReplicas(10))
+	hash.AddByIndex(0, 1, 2, 3, 4, 5, 6, 7, 8, 9, -1, 10)
+	if err := hash.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if len(hash.hashMap) != 10 {
+		t.Fatalf("expected 10 items, indices out of range are ignored, got %d", len(hash.hashMap))
+	}
+
+	hash.Remove(values[3])
+	for i := 0; i < 1000; i++ {
+		item := hash.Get([]byte(fmt.Sprintf("key-%d", i)))
+		if bytes.Equal(item, values[3]) {
+			t.Fatalf("expected the removed value not to be returned")
+		}
+		// the item is the value itself, not a copy
+		var found bool
+		for _, value := range values {
+			if &item[0] == &value[0] {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("expected the item to share the memory of the value")
+		}
+	}
+}
+
+func TestExternalValuesAddCopies(t *testing.T) {
+	hash := New(WithExternalValues(largeValues(2, 10)), WithDefaultReplicas(10))
+	buffer := []byte("node-a")
+	hash.Add(buffer)
+	copy(buffer, "node-b")
+	if item := hash.GetString("key"); item != "node-a" {
+		t.Errorf("expected Add to copy the key with WithExternalValues, got %q", item)
+	}
+}
+
+func BenchmarkLargeValues(b *testing.B) {
+	values := largeValues(1000, 4096)
+	indices := make([]int, len(values))
+	for i := range indices {
+		indices[i] = i
+	}
+	b.Run("Add", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			New(WithDefaultReplicas(10)).Add(values...)
+		}
+	})
+	b.Run("AddByIndex", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			New(WithExternalValues(values), WithDefaultReplicas(10)).AddByIndex(indices...)
+		}
+	})
+}
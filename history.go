@@ -0,0 +1,32 @@
+package consistenthash
+
+import "time"
+
+// ChangeRecord a change of the items in the ring kept by WithChangeHistory
+type ChangeRecord struct {
+	Type EventType
+	Key  []byte
+	Time time.Time
+}
+
+// History returns the last changes of the items in the ring, oldest first, only WithChangeHistory
+// the keys share the memory of the ring like Get, so they must not be changed
+func (ch *ConsistentHash) History() []ChangeRecord {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	history := make([]ChangeRecord, 0, len(ch.history))
+	history = append(history, ch.history[ch.historyStart:]...)
+	return append(history, ch.history[:ch.historyStart]...)
+}
+
+// record keeps the change in the history, replacing the oldest one if the history is full, the write lock must be held
+func (ch *ConsistentHash) record(eventType EventType, key []byte) {
+	change := ChangeRecord{Type: eventType, Key: key, Time: time.Now()}
+	if len(ch.history) < ch.historySize {
+		ch.history = append(ch.history, change)
+		return
+	}
+	ch.history[ch.historyStart] = change
+	ch.historyStart = (ch.historyStart + 1) % ch.historySize
+}
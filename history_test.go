@@ -0,0 +1,42 @@
+package consistenthash
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestChangeHistory(t *testing.T) {
+	hash := New(WithChangeHistory(5))
+	for i := 0; i < 4; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+		hash.Remove([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	// adding an existing item again is not a change
+	hash.Add([]byte("node-9"))
+	hash.Add([]byte("node-9"))
+
+	history := hash.History()
+	// only the last 5 of 9 changes are kept
+	expected := []RingEvent{
+		{EventAdded, []byte("node-2")},
+		{EventRemoved, []byte("node-2")},
+		{EventAdded, []byte("node-3")},
+		{EventRemoved, []byte("node-3")},
+		{EventAdded, []byte("node-9")},
+	}
+	if len(history) != len(expected) {
+		t.Fatalf("expected %d changes, got %d", len(expected), len(history))
+	}
+	for i, change := range history {
+		if change.Type != expected[i].Type || string(change.Key) != string(expected[i].Key) {
+			t.Errorf("expected change %d to be %v %s, got %v %s", i, expected[i].Type, expected[i].Key, change.Type, change.Key)
+		}
+		if i > 0 && change.Time.Before(history[i-1].Time) {
+			t.Errorf("expected the changes in order, change %d is before the previous one", i)
+		}
+	}
+
+	if history := New().History(); len(history) != 0 {
+		t.Errorf("expected no history without WithChangeHistory, got %d changes", len(history))
+	}
+}
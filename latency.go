@@ -0,0 +1,82 @@
+package consistenthash
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// latencySubBits each power of two of nanoseconds is divided to 2^latencySubBits buckets by the bits after the highest one
+	latencySubBits = 2
+	// latencyBuckets number of buckets to cover all the durations
+	latencyBuckets = 64 << latencySubBits
+)
+
+// latencyPercentiles the percentiles returned by LatencyPercentiles
+var latencyPercentiles = []float64{0.5, 0.9, 0.99, 0.999}
+
+// latencyHistogram counts the durations in buckets growing exponentially, each power of two is divided to
+// a few buckets, so the error of a percentile is less than 25%. The counters are updated atomically without locking
+type latencyHistogram struct {
+	counts [latencyBuckets]uint64
+}
+
+// since records the duration since the given time
+func (l *latencyHistogram) since(start time.Time) {
+	atomic.AddUint64(&l.counts[latencyBucket(uint64(time.Since(start)))], 1)
+}
+
+// latencyBucket returns the bucket of the duration in nanoseconds
+func latencyBucket(ns uint64) int {
+	if ns < 1<<latencySubBits {
+		return int(ns)
+	}
+	exponent := bits.Len64(ns) - 1
+	mantissa := (ns >> (exponent - latencySubBits)) & (1<<latencySubBits - 1)
+	return (exponent-latencySubBits+1)<<latencySubBits + int(mantissa)
+}
+
+// latencyBucketMax returns the biggest duration in nanoseconds of the bucket
+func latencyBucketMax(bucket int) uint64 {
+	if bucket < 1<<latencySubBits {
+		return uint64(bucket)
+	}
+	exponent := bucket>>latencySubBits + latencySubBits - 1
+	mantissa := uint64(bucket & (1<<latencySubBits - 1))
+	return (1<<latencySubBits+mantissa+1)<<(exponent-latencySubBits) - 1
+}
+
+// LatencyPercentiles returns the 50th, 90th, 99th and 99.9th percentiles of the durations of Get, only
+// WithLatencyMetrics, otherwise it's nil. Each percentile is the upper bound of the bucket it falls in
+func (ch *ConsistentHash) LatencyPercentiles() map[float64]time.Duration {
+	if ch.latencies == nil {
+		return nil
+	}
+	var counts [latencyBuckets]uint64
+	var total uint64
+	for i := range counts {
+		counts[i] = atomic.LoadUint64(&ch.latencies.counts[i])
+		total += counts[i]
+	}
+	percentiles := make(map[float64]time.Duration, len(latencyPercentiles))
+	if total == 0 {
+		return percentiles
+	}
+
+	var seen uint64
+	bucket := 0
+	for _, p := range latencyPercentiles {
+		// the rank of the percentile, at least the first duration
+		rank := uint64(p * float64(total))
+		if rank < 1 {
+			rank = 1
+		}
+		for seen+counts[bucket] < rank {
+			seen += counts[bucket]
+			bucket++
+		}
+		percentiles[p] = time.Duration(latencyBucketMax(bucket))
+	}
+	return percentiles
+}
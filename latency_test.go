@@ -0,0 +1,56 @@
+package consistenthash
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLatencyPercentiles(t *testing.T) {
+	if percentiles := New().LatencyPercentiles(); percentiles != nil {
+		t.Errorf("expected no percentiles without WithLatencyMetrics, got %v", percentiles)
+	}
+
+	hash := New(WithLatencyMetrics(), WithDefaultReplicas(10))
+	if percentiles := hash.LatencyPercentiles(); len(percentiles) != 0 {
+		t.Errorf("expected no percentiles before any Get, got %v", percentiles)
+	}
+	for i := 0; i < 10; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	for i := 0; i < 10000; i++ {
+		hash.Get([]byte(fmt.Sprintf("key-%d", i)))
+	}
+
+	percentiles := hash.LatencyPercentiles()
+	var previous time.Duration
+	for _, p := range []float64{0.5, 0.9, 0.99, 0.999} {
+		d, ok := percentiles[p]
+		if !ok || d <= 0 {
+			t.Fatalf("expected the percentile %v to be populated, got %v", p, percentiles)
+		}
+		if d < previous {
+			t.Errorf("expected the percentiles in order, got %v", percentiles)
+		}
+		previous = d
+	}
+}
+
+func TestLatencyBucket(t *testing.T) {
+	previous := -1
+	for _, ns := range []uint64{0, 1, 3, 4, 7, 8, 9, 10, 100, 1000, 1 << 40, 1<<64 - 1} {
+		bucket := latencyBucket(ns)
+		if bucket < previous || bucket >= latencyBuckets {
+			t.Errorf("expected bucket of %d to be in order, got %d after %d", ns, bucket, previous)
+		}
+		previous = bucket
+		// the duration is in its bucket, and less than 25% smaller than the upper bound
+		upper := latencyBucketMax(bucket)
+		if ns > upper || (ns > 4 && float64(upper-ns) > 0.25*float64(ns)) {
+			t.Errorf("expected %d to be close to the upper bound %d of its bucket", ns, upper)
+		}
+		if bucket > 0 && latencyBucketMax(bucket-1) >= ns {
+			t.Errorf("expected %d to be after the previous bucket ending at %d", ns, latencyBucketMax(bucket-1))
+		}
+	}
+}
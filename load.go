@@ -0,0 +1,82 @@
+package consistenthash
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// Acquire finds the closest item to the key walking clockwise, skipping the items at the bounded load (WithBoundedLoad),
+// and counts the acquisition in the load of the item until release is called. The load of an item is the number of
+// its acquisitions not released yet, bounded by c times the average load of the items including this acquisition,
+// rounded up. release must be called once the work is done, calling it again has no effect.
+// Without WithBoundedLoad it's the same as Get and release does nothing
+func (ch *ConsistentHash) Acquire(key []byte) (item []byte, release func()) {
+	release = func() {}
+	if ch.loads == nil {
+		return ch.Get(key), release
+	}
+	if !ch.allowEmptyKeys && len(key) == 0 {
+		return nil, release
+	}
+
+	hash, ok := ch.hashSafely(key)
+	if !ok {
+		return nil, release
+	}
+
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	if ch.totalKeys == 0 {
+		return nil, release
+	}
+	items := len(ch.hashMap)
+	total := atomic.AddInt64(&ch.inFlight, 1)
+	bound := int64(math.Ceil(ch.loadFactor * float64(total) / float64(items)))
+
+	var load *int64
+	var closest []byte
+	visited := make([]uint32, 0, 4)
+	ch.walk(ch.probe(hash), func(blockNumber uint32, idx int) bool {
+		pointer := ch.blocks[blockNumber][idx].pointer
+		if containsPointer(visited, pointer) {
+			return true
+		}
+		visited = append(visited, pointer)
+		candidate := ch.valueOf(blockNumber, idx)
+		if closest == nil {
+			closest = candidate
+		}
+		counter := ch.loadOf(candidate)
+		for current := atomic.LoadInt64(counter); current < bound; current = atomic.LoadInt64(counter) {
+			// increased only if it's still under the bound, so concurrent acquisitions can't exceed it
+			if atomic.CompareAndSwapInt64(counter, current, current+1) {
+				item, load = candidate, counter
+				return false
+			}
+		}
+		return len(visited) < items
+	})
+	if load == nil {
+		// all the items reached the bound meanwhile by concurrent acquisitions
+		item, load = closest, ch.loadOf(closest)
+		atomic.AddInt64(load, 1)
+	}
+
+	var released int32
+	return item, func() {
+		if atomic.CompareAndSwapInt32(&released, 0, 1) {
+			atomic.AddInt64(load, -1)
+			atomic.AddInt64(&ch.inFlight, -1)
+		}
+	}
+}
+
+// loadOf returns the load counter of the item, the read lock must be held
+func (ch *ConsistentHash) loadOf(item []byte) *int64 {
+	if counter, ok := ch.loads.Load(string(item)); ok {
+		return counter.(*int64)
+	}
+	counter, _ := ch.loads.LoadOrStore(string(item), new(int64))
+	return counter.(*int64)
+}
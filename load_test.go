@@ -0,0 +1,85 @@
+package consistenthash
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// loadsOf returns the current load of each item
+func loadsOf(hash *ConsistentHash) map[string]int64 {
+	loads := make(map[string]int64)
+	hash.loads.Range(func(item, counter any) bool {
+		loads[item.(string)] = atomic.LoadInt64(counter.(*int64))
+		return true
+	})
+	return loads
+}
+
+func TestAcquire(t *testing.T) {
+	hash := New(WithBoundedLoad(1.25), WithDefaultReplicas(20))
+	for i := 0; i < 10; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+
+	const workers, perWorker = 8, 100
+	releases := make(chan func(), workers*perWorker)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				// half of the acquisitions are for the same hot key
+				key := "hot"
+				if i%2 == 0 {
+					key = fmt.Sprintf("key-%d-%d", w, i)
+				}
+				item, release := hash.Acquire([]byte(key))
+				if item == nil {
+					t.Errorf("expected an item for %s", key)
+				}
+				releases <- release
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(releases)
+
+	// the bound only grows while nothing is released, so no item is over the final bound
+	bound := int64(math.Ceil(1.25 * workers * perWorker / 10))
+	var total int64
+	for item, load := range loadsOf(hash) {
+		if load > bound {
+			t.Errorf("expected %s to have at most %d acquisitions, got %d", item, bound, load)
+		}
+		total += load
+	}
+	if total != workers*perWorker {
+		t.Errorf("expected %d acquisitions, got %d", workers*perWorker, total)
+	}
+
+	for release := range releases {
+		release()
+		release() // released only once
+	}
+	for item, load := range loadsOf(hash) {
+		if load != 0 {
+			t.Errorf("expected all the acquisitions of %s to be released, got %d", item, load)
+		}
+	}
+	if inFlight := atomic.LoadInt64(&hash.inFlight); inFlight != 0 {
+		t.Errorf("expected no acquisitions in flight, got %d", inFlight)
+	}
+
+	// without bounded load it's the same as Get
+	unbounded := New()
+	unbounded.Add([]byte("Bill"), []byte("Bob"))
+	item, release := unbounded.Acquire([]byte("key"))
+	release()
+	if string(item) != unbounded.GetString("key") {
+		t.Errorf("expected the same item as Get, got %q", item)
+	}
+}
@@ -0,0 +1,48 @@
+package consistenthash
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+func TestMurmur32(t *testing.T) {
+	testCases := map[string]uint32{
+		"":      0,
+		"hello": 0x248bfa47,
+		"The quick brown fox jumps over the lazy dog": 0x2e4ff723,
+	}
+	for k, v := range testCases {
+		if h := murmur32([]byte(k)); h != v {
+			t.Errorf("murmur32(%q) should be %x, got %x", k, v, h)
+		}
+	}
+}
+
+func TestMurmur32Distribution(t *testing.T) {
+	crcVariance := loadVariance(New(WithDefaultReplicas(100)))
+	murmurVariance := loadVariance(New(WithDefaultReplicas(100), WithMurmur32()))
+	if murmurVariance >= crcVariance {
+		t.Errorf("expected murmur3 variance %.1f to be lower than crc32 variance %.1f", murmurVariance, crcVariance)
+	}
+}
+
+// loadVariance returns the variance of number of keys per node for 10k sequential integer keys over 10 nodes
+func loadVariance(hash *ConsistentHash) float64 {
+	nodes, keys := 10, 10000
+	for i := 0; i < nodes; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	load := make(map[string]int, nodes)
+	for i := 0; i < keys; i++ {
+		load[hash.GetString(strconv.Itoa(i))]++
+	}
+
+	var variance float64
+	mean := float64(keys / nodes)
+	for i := 0; i < nodes; i++ {
+		d := float64(load[fmt.Sprintf("node-%d", i)]) - mean
+		variance += d * d
+	}
+	return variance / float64(nodes)
+}
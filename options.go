@@ -4,6 +4,41 @@ type options struct {
 	hashFunc          HashFunc
 	defaultReplicas   uint
 	blockPartitioning int
+	arrayTable        bool
+	logger            Logger
+	maxVirtualNodes   int
+	members           [][]byte
+	allowEmptyKeys    bool
+	copyKeys          bool
+	gallopingSearch   bool
+	lazyRebuild       int
+	shared            *SharedConfig
+	verifiedBlocks    bool
+	keyNormalizer     func(string) string
+	eventBuffer       int
+	blockOnEvents     bool
+	replicaJitter     bool
+	jitterSeed        uint64
+	cachedKeys        [][]byte
+	multiProbe        int
+	adaptiveBlocks    bool
+	collisionChaining bool
+	rebuildThreshold  float64
+	capacity          int
+	withoutBlocks     bool
+	maxProbeBlocks    int
+	nodeTimestamps    bool
+	recoverHashPanics bool
+	changeHistory     int
+	nodeHasher        func(key []byte, index uint32) uint32
+	latencyMetrics    bool
+	externalValues    [][]byte
+	ringSize          uint64
+	loadFactor        float64
+	getNCache         int
+	arcCoverage       bool
+	readLocks         int
+	capacityCallback  func(attemptedTotal int) bool
 }
 
 type Option func(*options)
@@ -22,9 +57,283 @@ func WithHashFunc(hashFunc HashFunc) Option {
 	}
 }
 
+// WithMurmur32 uses 32bit murmur3 as the hash function, which spreads structured keys better than the default crc32
+func WithMurmur32() Option {
+	return WithHashFunc(murmur32)
+}
+
 // WithBlockPartitioning uses block partitioning, divides total number of keys to the given number to get number of blocks
 func WithBlockPartitioning(divisionBy int) Option {
 	return func(o *options) {
 		o.blockPartitioning = divisionBy
 	}
 }
+
+// WithoutBlocks keeps all the keys in a single sorted block regardless of WithBlockPartitioning, so every lookup is
+// a binary search over all the keys, useful as a reference to compare the routing with blocks against
+func WithoutBlocks() Option {
+	return func(o *options) {
+		o.withoutBlocks = true
+	}
+}
+
+// WithMaxProbeBlocks searches at most the given number of blocks for the closest key before jumping straight to
+// the next occupied block, so a lookup in a sparse region of the circle doesn't visit every empty block on the way
+func WithMaxProbeBlocks(n int) Option {
+	return func(o *options) {
+		o.maxProbeBlocks = n
+	}
+}
+
+// WithNodeTimestamps records the time each key is added to the ring, returned as its age by NodeAge
+func WithNodeTimestamps() Option {
+	return func(o *options) {
+		o.nodeTimestamps = true
+	}
+}
+
+// WithRecoverHashPanics recovers the panics of the hash function, keys it panics on are skipped by Add
+// and Get returns nil for them instead of panicking
+func WithRecoverHashPanics() Option {
+	return func(o *options) {
+		o.recoverHashPanics = true
+	}
+}
+
+// WithChangeHistory keeps the last n changes of the items in the ring, returned by History
+// to see the recent changes of a flapping item without external logging
+func WithChangeHistory(n int) Option {
+	return func(o *options) {
+		o.changeHistory = n
+	}
+}
+
+// WithVirtualNodeHasher hashes each replica of a key by the key and the replica index, instead of hashing the key
+// with the index appended, the first position of a key is still the hash of the key by the hash function
+func WithVirtualNodeHasher(hasher func(key []byte, index uint32) uint32) Option {
+	return func(o *options) {
+		o.nodeHasher = hasher
+	}
+}
+
+// WithLatencyMetrics records the duration of each Get, returned as percentiles by LatencyPercentiles
+// the durations are counted atomically, but measuring the time is still a cost on every Get
+func WithLatencyMetrics() Option {
+	return func(o *options) {
+		o.latencyMetrics = true
+	}
+}
+
+// WithExternalValues stores the items added by AddByIndex without copying them, so the ring doesn't keep another copy
+// of large values held elsewhere. The ring shares the memory of the values, which must not be changed after adding
+func WithExternalValues(values [][]byte) Option {
+	return func(o *options) {
+		o.externalValues = values
+	}
+}
+
+// WithRingSize folds the hashes into a circle of the given number of positions, so the positions are in [0, size)
+// like the tokens of a fixed size token ring, sizes less than 2 or more than 2^32 are ignored
+func WithRingSize(size uint64) Option {
+	return func(o *options) {
+		o.ringSize = size
+	}
+}
+
+// WithBoundedLoad makes Acquire skip the items with more than c times the average load of the items,
+// c less than 1 is taken as 1, which spreads the load evenly but moves more keys to other items
+func WithBoundedLoad(c float64) Option {
+	return func(o *options) {
+		o.loadFactor = c
+	}
+}
+
+// WithGetNCache caches the results of GetN for the given number of the least recently used keys and n,
+// the cached results are computed again after any change of the ring
+func WithGetNCache(size int) Option {
+	return func(o *options) {
+		o.getNCache = size
+	}
+}
+
+// WithArcCoverage keeps the share of the circle owned by each item up to date while adding and removing,
+// so ArcShare, RemoveIfUnderloaded and EqualizeArcs don't visit all the positions of the ring
+func WithArcCoverage() Option {
+	return func(o *options) {
+		o.arcCoverage = true
+	}
+}
+
+// WithShardedReadLocks makes Get take one of n reader locks by the hash of the key instead of the lock of the ring,
+// so concurrent readers of different keys don't share the reader count of a single lock. Changing the ring takes
+// all n locks, which makes writes slower, and Get doesn't count the lookups, so MissRate and WithAdaptiveBlocks
+// don't see them. n less than 2 is ignored
+func WithShardedReadLocks(n int) Option {
+	return func(o *options) {
+		o.readLocks = n
+	}
+}
+
+// WithArrayTable stores the values aligned with the keys in each block, so Get resolves the value without the hash table lookup
+func WithArrayTable() Option {
+	return func(o *options) {
+		o.arrayTable = true
+	}
+}
+
+// WithLogger logger to report internal events like changing the number of blocks or hash collisions
+// the logger is never called while holding the lock, so it's safe to use the ring inside the logger
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithMaxVirtualNodes keeps the total number of virtual nodes around max by changing the default number of replicas
+// to max / number of keys whenever keys are added or removed, keys added with a different number of replicas keep it
+func WithMaxVirtualNodes(max int) Option {
+	return func(o *options) {
+		o.maxVirtualNodes = max
+	}
+}
+
+// WithCapacity limits the total number of virtual nodes, adding keys which exceed it adds nothing unless
+// the callback of WithOnCapacityExceeded allows it, unlike WithMaxVirtualNodes the number of replicas is not changed
+func WithCapacity(max int) Option {
+	return func(o *options) {
+		o.capacity = max
+	}
+}
+
+// WithOnCapacityExceeded calls fn with the total number of virtual nodes an add would make when it exceeds WithCapacity,
+// the add goes ahead if fn returns true. fn is called while holding the lock, so it must not use the ring
+func WithOnCapacityExceeded(fn func(attemptedTotal int) bool) Option {
+	return func(o *options) {
+		o.capacityCallback = fn
+	}
+}
+
+// WithMembers adds the given keys while making the ring, keys are sorted before adding,
+// so the ring is the same regardless of the order of the keys
+func WithMembers(keys ...[]byte) Option {
+	return func(o *options) {
+		o.members = append(o.members, keys...)
+	}
+}
+
+// WithAllowEmptyKeys allows adding and getting empty keys, nil and empty keys are treated the same
+// by default empty keys are skipped by Add and Get returns nil for them
+func WithAllowEmptyKeys(allow bool) Option {
+	return func(o *options) {
+		o.allowEmptyKeys = allow
+	}
+}
+
+// WithCopyKeys copies the keys before storing them, which is the default
+// without copying the ring shares the memory of the given keys, so changing or reusing a key's buffer after
+// adding it changes the item stored in the ring as well, use false only if the keys are never changed after adding
+func WithCopyKeys(copyKeys bool) Option {
+	return func(o *options) {
+		o.copyKeys = copyKeys
+	}
+}
+
+// WithGallopingSearch searches inside blocks by doubling the range from the smallest key before the binary search
+// which is faster for large blocks when the hash is close to the block's smallest key
+func WithGallopingSearch() Option {
+	return func(o *options) {
+		o.gallopingSearch = true
+	}
+}
+
+// WithLazyRebuild defers resizing the blocks on Remove until the given number of keys are removed
+// lookups stay correct in the meantime as the blocks are only resized, not the positions
+func WithLazyRebuild(threshold int) Option {
+	return func(o *options) {
+		o.lazyRebuild = threshold
+	}
+}
+
+// WithRebuildThreshold resizes the blocks only when the number of keys is changed by more than the given fraction
+// since the last resize, 0.1 resizes after a 10% change. Without it the blocks are resized when the number of keys
+// is doubled or halved, a smaller fraction keeps the blocks closer to the block partitioning at the cost of more resizes
+func WithRebuildThreshold(fraction float64) Option {
+	return func(o *options) {
+		o.rebuildThreshold = fraction
+	}
+}
+
+// WithVerifiedBlocks checks the item found by Get is the closest to the hash by comparing it with the previous key in the circle
+// and searches all the keys if it's not, so Get doesn't depend on the blocks being correct
+func WithVerifiedBlocks() Option {
+	return func(o *options) {
+		o.verifiedBlocks = true
+	}
+}
+
+// WithKeyNormalizer normalizes the keys given to the string methods (AddString, RemoveString, GetString and GetString2)
+// like unicode normalization or case folding, the []byte methods use the keys as they are
+func WithKeyNormalizer(normalizer func(string) string) Option {
+	return func(o *options) {
+		o.keyNormalizer = normalizer
+	}
+}
+
+// WithEventBuffer sends the changes of the items to the channel returned by Events with the given buffer size
+// events are dropped when the buffer is full, unless block is set, then the change waits until they are received.
+// Events are sent after releasing the lock either way, so a blocked change doesn't block the other callers
+func WithEventBuffer(size int, block bool) Option {
+	return func(o *options) {
+		if size < 0 {
+			size = 0
+		}
+		o.eventBuffer = size
+		o.blockOnEvents = block
+	}
+}
+
+// WithReplicaJitter mixes the seed into the positions of the replicas, so replicas of keys with common prefixes
+// don't end up in correlated clusters. It changes the layout of the ring, so all the members of a cluster
+// must use the same seed to agree on the routing. The original position of each key is not changed
+func WithReplicaJitter(seed uint64) Option {
+	return func(o *options) {
+		o.replicaJitter = true
+		o.jitterSeed = seed
+	}
+}
+
+// WithResultCache caches the result of Get for the given hot keys, the cached results are computed again
+// by the first Get after any change in the ring
+func WithResultCache(keys [][]byte) Option {
+	return func(o *options) {
+		o.cachedKeys = append(o.cachedKeys, keys...)
+	}
+}
+
+// WithMultiProbe adds each key with a single position in the circle and makes Get probe k hashes of the key instead,
+// choosing the key closest to any of the probes. It balances the load like many replicas without storing them,
+// at the cost of k lookups per Get. The number of replicas given to Add, AddReplicas or AddWeighted is ignored
+func WithMultiProbe(k int) Option {
+	return func(o *options) {
+		o.multiProbe = k
+	}
+}
+
+// WithAdaptiveBlocks tunes the block partitioning from the miss rate of Get while adding and removing keys,
+// keeping the average number of keys per block between 4 and 16, the given block partitioning is the starting point
+// and limited to 4 to 8, so the blocks can grow before they are resized
+func WithAdaptiveBlocks() Option {
+	return func(o *options) {
+		o.adaptiveBlocks = true
+	}
+}
+
+// WithCollisionChaining keeps both keys when the hashes of two keys collide, instead of replacing the first key.
+// The smaller key keeps the hash and the other one is stored by a secondary hash, the hash of the reversed key,
+// so both keys have their own positions in the circle regardless of the order they are added.
+// When every hash of the circle is taken (WithRingSize), the colliding key replaces the first key and it's logged
+func WithCollisionChaining() Option {
+	return func(o *options) {
+		o.collisionChaining = true
+	}
+}
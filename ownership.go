@@ -0,0 +1,191 @@
+package consistenthash
+
+import (
+	"bytes"
+	"math"
+	"sort"
+)
+
+// ringSize number of positions in the circle, unless WithRingSize
+const ringSize = math.MaxUint32 + 1
+
+// OwnershipArcs returns the arcs of the circle each item is responsible for as [start, end) pairs
+// a key belongs to an item if its hash falls in one of the item's arcs, adjacent arcs of an item are merged
+func (ch *ConsistentHash) OwnershipArcs() map[string][][2]uint64 {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	arcs := make(map[string][][2]uint64, len(ch.hashMap))
+	var start uint64
+	var last string
+	var lastEnd uint64
+	for blockNumber := uint32(0); blockNumber < ch.totalBlocks; blockNumber++ {
+		for _, n := range ch.blocks[blockNumber] {
+			owner := string(ch.hashMap[n.pointer])
+			end := uint64(n.key) + 1
+			if owner == last && len(arcs[owner]) > 0 {
+				// extend the previous arc of the same item
+				arcs[owner][len(arcs[owner])-1][1] = end
+			} else {
+				arcs[owner] = append(arcs[owner], [2]uint64{start, end})
+			}
+			start, last, lastEnd = end, owner, end
+		}
+	}
+	if lastEnd == 0 || lastEnd == ch.ringSize {
+		return arcs
+	}
+
+	// the keys after the last position belong to the first position in the circle
+	first := string(ch.valueOfFirst())
+	if first == last {
+		arcs[first][len(arcs[first])-1][1] = ch.ringSize
+	} else {
+		arcs[first] = append(arcs[first], [2]uint64{lastEnd, ch.ringSize})
+	}
+	return arcs
+}
+
+// RemoveIfUnderloaded removes the key only if the share of the circle it owns is less than maxShare,
+// the share is the total length of its arcs divided by the size of the circle, returns whether it's removed
+func (ch *ConsistentHash) RemoveIfUnderloaded(key []byte, maxShare float64) bool {
+	// hashed before locking, so a panicking hash function doesn't leave the lock held
+	hash := ch.hash(key)
+
+	// checked and removed under the same lock, so the share can't change in between
+	ch.lock()
+	defer ch.unlock()
+
+	originalHash, existing, ok := ch.identifyHash(hash, key)
+	if !ok || !bytes.Equal(existing, key) || ch.shareOf(originalHash) >= maxShare {
+		return false
+	}
+	replicas, found := ch.replicaMap[originalHash]
+	if !found {
+		replicas = ch.replicas
+	}
+	nodes := ch.appendSalted(make([]node, 0, nodesCap(1, replicas)), originalHash, key, replicas, 0)
+	return ch.removeKey(key, originalHash, replicas, found, nodes)
+}
+
+// shareOf returns the share of the circle owned by the positions pointing to the original hash, the read lock must be held
+func (ch *ConsistentHash) shareOf(originalHash uint32) float64 {
+	if ch.arcCoverage != nil {
+		return float64(ch.arcCoverage[originalHash]) / float64(ch.ringSize)
+	}
+	if ch.totalKeys == 0 {
+		return 0
+	}
+	// each position owns the arc after the previous position, the first one owns the arc after the last one
+	previous := ch.previous(ch.firstBlock(), 0).key
+	var owned uint64
+	for blockNumber := uint32(0); blockNumber < ch.totalBlocks; blockNumber++ {
+		for _, n := range ch.blocks[blockNumber] {
+			if n.pointer == originalHash {
+				if ch.totalKeys == 1 {
+					return 1
+				}
+				owned += arcOf(previous, n.key, ch.ringSize)
+			}
+			previous = n.key
+		}
+	}
+	return float64(owned) / float64(ch.ringSize)
+}
+
+// firstBlock returns the number of the first non-empty block, the read lock must be held and the ring must not be empty
+func (ch *ConsistentHash) firstBlock() uint32 {
+	for blockNumber := uint32(0); blockNumber < ch.totalBlocks; blockNumber++ {
+		if len(ch.blocks[blockNumber]) > 0 {
+			return blockNumber
+		}
+	}
+	return 0
+}
+
+// valueOfFirst returns the item of the first position in the circle, the read lock must be held
+func (ch *ConsistentHash) valueOfFirst() []byte {
+	for blockNumber := uint32(0); blockNumber < ch.totalBlocks; blockNumber++ {
+		if len(ch.blocks[blockNumber]) > 0 {
+			return ch.valueOf(blockNumber, 0)
+		}
+	}
+	return nil
+}
+
+// OwnershipDistribution returns how many of m evenly spaced points in the circle each item owns,
+// which estimates the share of a uniformly hashed keyspace each item is responsible for
+func (ch *ConsistentHash) OwnershipDistribution(m int) map[string]int {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	counts := make(map[string]int, len(ch.hashMap))
+	if m < 1 || ch.totalKeys == 0 {
+		return counts
+	}
+	for i := 0; i < m; i++ {
+		counts[string(ch.get(uint32(uint64(i)*ch.ringSize/uint64(m))))]++
+	}
+	return counts
+}
+
+// Partition returns which of numPartitions equal arcs of the circle the hash of the key falls in, independent of the items
+// the item owning a partition can be found by GetByHashHint with the start of its arc, partition * 2^32 / numPartitions
+func (ch *ConsistentHash) Partition(key []byte, numPartitions int) int {
+	hash, ok := ch.hashSafely(key)
+	if numPartitions < 1 || !ok {
+		return 0
+	}
+	return int(uint64(hash) * uint64(numPartitions) / ch.ringSize)
+}
+
+// MembersInRange returns the items whose original position in the circle is in [lo, hi), sorted by their position
+// the range wraps around the end of the circle when lo > hi, and covers the whole circle when lo == hi,
+// both ends are clamped to the ring size (WithRingSize), so [0, ring size) is the whole circle as well
+func (ch *ConsistentHash) MembersInRange(lo, hi uint64) [][]byte {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	whole := lo == hi
+	if lo > ch.ringSize {
+		lo = ch.ringSize
+	}
+	if hi > ch.ringSize {
+		hi = ch.ringSize
+	}
+	positions := make([]uint32, 0)
+	for originalHash := range ch.hashMap {
+		position := uint64(originalHash)
+		if whole || (lo <= hi && lo <= position && position < hi) || (lo > hi && (position >= lo || position < hi)) {
+			positions = append(positions, originalHash)
+		}
+	}
+	// shifting by lo makes the range start at 0, also when it wraps around
+	shifted := func(position uint32) uint64 {
+		if uint64(position) < lo {
+			return uint64(position) + ch.ringSize - lo
+		}
+		return uint64(position) - lo
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		return shifted(positions[i]) < shifted(positions[j])
+	})
+	members := make([][]byte, len(positions))
+	for i, position := range positions {
+		members[i] = ch.hashMap[position]
+	}
+	return members
+}
+
+// OwnerOfPosition returns the item owning the position of the circle, the item of the closest position clockwise,
+// which is the first position in the circle if the position is after the last one. Unlike GetByHashHint
+// the position is not probed (WithMultiProbe) and pinned keys are ignored, as it's not the hash of a key
+func (ch *ConsistentHash) OwnerOfPosition(position uint32) []byte {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	if blockNumber, idx, ok := ch.lookup(position); ok {
+		return ch.valueOf(blockNumber, idx)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package consistenthash
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestOwnershipArcs(t *testing.T) {
+	// keys are their own hash, so the positions are known
+	hash := New(WithBlockPartitioning(1), WithHashFunc(identityHash))
+	hash.Add([]byte("100"), []byte("2000000000"), []byte("3000000000"))
+	hash.AddReplicas(2, []byte("4000000000")) // the replica hashes to 0, so it's next to 100
+
+	ownership := hash.OwnershipArcs()
+	if len(ownership) != 4 {
+		t.Fatalf("expected 4 owners, got %v", ownership)
+	}
+
+	var arcs [][2]uint64
+	for owner, ownerArcs := range ownership {
+		for _, arc := range ownerArcs {
+			arcs = append(arcs, arc)
+			// the last key in the arc belongs to the owner
+			if v := hash.GetString(strconv.FormatUint(arc[1]-1, 10)); v != owner {
+				t.Errorf("expected %d to belong to %s, got %s", arc[1]-1, owner, v)
+			}
+		}
+	}
+	sort.Slice(arcs, func(i, j int) bool { return arcs[i][0] < arcs[j][0] })
+	var next uint64
+	for _, arc := range arcs {
+		if arc[0] != next || arc[1] <= arc[0] {
+			t.Fatalf("expected arcs to tile the circle, got %v", arcs)
+		}
+		next = arc[1]
+	}
+	if next != ringSize {
+		t.Errorf("expected arcs to cover the whole circle, got %v", arcs)
+	}
+
+	expected := [][2]uint64{{0, 1}, {3000000001, ringSize}}
+	if a := ownership["4000000000"]; len(a) != 2 || a[0] != expected[0] || a[1] != expected[1] {
+		t.Errorf("expected arcs %v for the wrapping item, got %v", expected, a)
+	}
+}
+
+func TestPartition(t *testing.T) {
+	hash := New(WithMurmur32())
+	counts := make([]int, 16)
+	for i := 0; i < 160000; i++ {
+		p := hash.Partition([]byte(fmt.Sprintf("key-%d", i)), len(counts))
+		if p < 0 || p >= len(counts) {
+			t.Fatalf("partition %d is out of range", p)
+		}
+		counts[p]++
+	}
+	for p, count := range counts {
+		if count < 9000 || count > 11000 {
+			t.Errorf("expected around 10000 keys in partition %d, got %d", p, count)
+		}
+	}
+
+	// partitions are the same regardless of the items
+	hash.Add([]byte("Bill"), []byte("Bob"))
+	if p := hash.Partition([]byte("key-1"), 16); p != New(WithMurmur32()).Partition([]byte("key-1"), 16) {
+		t.Errorf("expected the partition to be independent of the items, got %d", p)
+	}
+	if p := hash.Partition([]byte("key-1"), 0); p != 0 {
+		t.Errorf("expected partition 0 without partitions, got %d", p)
+	}
+}
+
+func TestMembersInRange(t *testing.T) {
+	hash := New(WithDefaultReplicas(10))
+	all := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("node-%d", i)
+		hash.Add([]byte(key))
+		all[key] = true
+	}
+
+	seen := make(map[string]bool)
+	quarter := uint64(1 << 30)
+	for i := uint64(0); i < 4; i++ {
+		for _, member := range hash.MembersInRange(i*quarter, (i+1)*quarter) {
+			if seen[string(member)] {
+				t.Fatalf("expected %s only in one range", member)
+			}
+			if position := uint64(hash.HashKey(member)); position < i*quarter || position >= (i+1)*quarter {
+				t.Fatalf("expected position %d of %s in range %d", position, member, i)
+			}
+			seen[string(member)] = true
+		}
+	}
+	if len(seen) != len(all) {
+		t.Fatalf("expected all %d members in the ranges, got %d", len(all), len(seen))
+	}
+
+	for _, r := range [][2]uint64{{7, 7}, {0, 1 << 32}, {0, math.MaxUint64}} {
+		if members := hash.MembersInRange(r[0], r[1]); len(members) != len(all) {
+			t.Errorf("expected the whole circle for %v, got %d members", r, len(members))
+		}
+	}
+	wrapped := hash.MembersInRange(3*quarter, quarter)
+	if len(wrapped) != len(hash.MembersInRange(3*quarter, 4*quarter))+len(hash.MembersInRange(0, quarter)) {
+		t.Errorf("expected the wrapped range to contain both ends of the circle")
+	}
+	if len(wrapped) > 1 && hash.HashKey(wrapped[0])-uint32(3*quarter) > hash.HashKey(wrapped[1])-uint32(3*quarter) {
+		t.Errorf("expected members sorted from the start of the range")
+	}
+
+	// the ends are clamped to the ring size
+	small := New(WithRingSize(1<<16), WithDefaultReplicas(10))
+	small.Add([]byte("Bill"), []byte("Bob"), []byte("Bonny"))
+	if members := small.MembersInRange(0, 1<<32); len(members) != 3 {
+		t.Errorf("expected all members of the smaller ring, got %d", len(members))
+	}
+	if members := small.MembersInRange(1<<20, 1<<16); len(members) != 0 {
+		t.Errorf("expected no members after the end of the smaller ring, got %d", len(members))
+	}
+}
+
+func TestRemoveIfUnderloaded(t *testing.T) {
+	// keys are their own hash, so the positions are known
+	hash := New(WithHashFunc(identityHash))
+	// 1000000000 owns (0, 1000000000] and 4000000000 owns the rest of the circle
+	hash.Add([]byte("0"), []byte("1000000000"), []byte("4000000000"))
+
+	if hash.RemoveIfUnderloaded([]byte("4000000000"), 0.5) {
+		t.Errorf("expected the overloaded key not to be removed")
+	}
+	if hash.GetString("2000000000") != "4000000000" {
+		t.Errorf("expected the overloaded key to stay in the ring")
+	}
+	if hash.RemoveIfUnderloaded([]byte("123"), 1) {
+		t.Errorf("expected a missing key not to be removed")
+	}
+	if !hash.RemoveIfUnderloaded([]byte("1000000000"), 0.5) {
+		t.Errorf("expected the underloaded key to be removed")
+	}
+	if hash.GetString("500") != "4000000000" {
+		t.Errorf("expected the arc of the removed key to move to the next key")
+	}
+
+	// the only key owns the whole circle
+	hash.Remove([]byte("0"))
+	if hash.RemoveIfUnderloaded([]byte("4000000000"), 0.99) {
+		t.Errorf("expected the only key not to be removed")
+	}
+}
+
+func TestOwnershipDistribution(t *testing.T) {
+	hash := New(WithMurmur32(), WithDefaultReplicas(200))
+	for i := 0; i < 10; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+
+	counts := hash.OwnershipDistribution(10000)
+	var total int
+	for node, count := range counts {
+		if count < 700 || count > 1300 {
+			t.Errorf("expected about 1000 points for %s, got %d", node, count)
+		}
+		total += count
+	}
+	if len(counts) != 10 || total != 10000 {
+		t.Errorf("expected 10000 points for 10 nodes, got %d for %d", total, len(counts))
+	}
+	if counts := New().OwnershipDistribution(10); len(counts) != 0 {
+		t.Errorf("expected no counts for an empty ring, got %v", counts)
+	}
+}
+
+func TestOwnerOfPosition(t *testing.T) {
+	// keys are their own hash, so the positions are known
+	hash := New(WithBlockPartitioning(1), WithMultiProbe(4), WithHashFunc(identityHash))
+	if owner := hash.OwnerOfPosition(0); owner != nil {
+		t.Errorf("expected no owner in an empty ring, got %q", owner)
+	}
+	hash.Add([]byte("100"), []byte("2000000000"), []byte("3000000000"))
+
+	for position, expected := range map[uint32]string{
+		0:          "100",
+		100:        "100",
+		101:        "2000000000",
+		1999999999: "2000000000",
+		2000000001: "3000000000",
+		3000000000: "3000000000",
+		3000000001: "100", // wraps around
+		4294967295: "100",
+	} {
+		if owner := hash.OwnerOfPosition(position); string(owner) != expected {
+			t.Errorf("expected %s to own position %d, got %s", expected, position, owner)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package consistenthash
+
+import "bytes"
+
+// pin the item a key is pinned to
+type pin struct {
+	originalHash uint32
+	item         []byte
+}
+
+// Pin makes Get return the item for the key regardless of the ring, as long as the item is in the ring
+// keys are pinned by their hash, so keys with the same hash are pinned together
+func (ch *ConsistentHash) Pin(key []byte, item []byte) {
+	p := pin{originalHash: ch.hash(item), item: append(make([]byte, 0, len(item)), item...)}
+	hash := ch.hash(key)
+
+	ch.lock()
+	defer ch.unlock()
+	if ch.pins == nil {
+		ch.pins = make(map[uint32]pin)
+	}
+	ch.pins[hash] = p
+}
+
+// Unpin removes the pinned item of the key
+func (ch *ConsistentHash) Unpin(key []byte) {
+	hash := ch.hash(key)
+
+	ch.lock()
+	defer ch.unlock()
+	delete(ch.pins, hash)
+}
+
+// pinned returns the pinned item of the hash if it's in the ring, the read lock must be held
+func (ch *ConsistentHash) pinned(hash uint32) ([]byte, bool) {
+	p, ok := ch.pins[hash]
+	if !ok {
+		return nil, false
+	}
+	if v, ok := ch.hashMap[p.originalHash]; ok && bytes.Equal(v, p.item) {
+		return v, true
+	}
+	return nil, false
+}
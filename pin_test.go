@@ -0,0 +1,61 @@
+package consistenthash
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPin(t *testing.T) {
+	hash := New(WithDefaultReplicas(20))
+	hash.Add([]byte("Bill"), []byte("Bob"), []byte("Bonny"))
+
+	hash.Pin([]byte("tenant"), []byte("Bob"))
+	hash.Pin([]byte("Bill"), []byte("Bonny"))
+	if v := hash.GetString("tenant"); v != "Bob" {
+		t.Errorf("expected the pinned item Bob, got %s", v)
+	}
+	if v := hash.GetString("Bill"); v != "Bonny" {
+		t.Errorf("expected the pinned item to win over the exact match, got %s", v)
+	}
+
+	before := make(map[string]string)
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		before[key] = hash.GetString(key)
+	}
+	for i := 0; i < 10; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	var moved int
+	for key, v := range before {
+		if hash.GetString(key) != v {
+			moved++
+		}
+	}
+	if moved == 0 {
+		t.Errorf("expected unpinned keys to move")
+	}
+	if v := hash.GetString("tenant"); v != "Bob" {
+		t.Errorf("expected the pinned item to ignore the changes, got %s", v)
+	}
+
+	// the pin is ignored while the item is not in the ring
+	hash.Remove([]byte("Bob"))
+	if v := hash.GetString("tenant"); v == "Bob" || v == "" {
+		t.Errorf("expected an item from the ring, got %q", v)
+	}
+	hash.Add([]byte("Bob"))
+	if v := hash.GetString("tenant"); v != "Bob" {
+		t.Errorf("expected the pinned item after adding it again, got %s", v)
+	}
+
+	hash.Unpin([]byte("tenant"))
+	for i := 0; i < 10; i++ {
+		hash.Remove([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	expected := New(WithDefaultReplicas(20))
+	expected.Add([]byte("Bill"), []byte("Bob"), []byte("Bonny"))
+	if v := hash.GetString("tenant"); v != expected.GetString("tenant") {
+		t.Errorf("expected the ring to route the unpinned key to %s, got %s", expected.GetString("tenant"), v)
+	}
+}
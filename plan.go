@@ -0,0 +1,63 @@
+package consistenthash
+
+import "bytes"
+
+// RemoveAndPlan removes the key and returns the new item of each of the affected keys routed to it before removing,
+// by the same locked step, so the plan matches the ring right after the removal. Affected keys routed to other items
+// are not in the plan, and the new item is nil if the ring is empty after removing. It returns nil if the key doesn't exist
+func (ch *ConsistentHash) RemoveAndPlan(key []byte, affectedKeys [][]byte) map[string][]byte {
+	// hashed before locking, so a panicking hash function doesn't leave the lock held
+	hash := ch.hash(key)
+	hashes := make([]uint32, 0, len(affectedKeys))
+	keys := make([][]byte, 0, len(affectedKeys))
+	for _, affected := range affectedKeys {
+		if !ch.allowEmptyKeys && len(affected) == 0 {
+			continue
+		}
+		if h, ok := ch.hashSafely(affected); ok {
+			hashes = append(hashes, h)
+			keys = append(keys, affected)
+		}
+	}
+
+	ch.lock()
+	defer ch.unlock()
+
+	originalHash, existing, ok := ch.identifyHash(hash, key)
+	if !ok || !bytes.Equal(existing, key) {
+		return nil
+	}
+	moved := make([]int, 0)
+	for i, h := range hashes {
+		if bytes.Equal(ch.route(h), key) {
+			moved = append(moved, i)
+		}
+	}
+
+	replicas, found := ch.replicaMap[originalHash]
+	if !found {
+		replicas = ch.replicas
+	}
+	nodes := ch.appendSalted(make([]node, 0, nodesCap(1, replicas)), originalHash, key, replicas, 0)
+	ch.removeKey(key, originalHash, replicas, found, nodes)
+
+	plan := make(map[string][]byte, len(moved))
+	for _, i := range moved {
+		plan[string(keys[i])] = ch.route(hashes[i])
+	}
+	return plan
+}
+
+// route returns the item of the hash like GetByHashHint without the result cache, which is only valid
+// for the generation of the ring, so it can be used while changing the ring, the lock must be held
+func (ch *ConsistentHash) route(hash uint32) []byte {
+	if ch.totalKeys == 0 {
+		return nil
+	}
+	if ch.pins != nil {
+		if v, ok := ch.pinned(hash); ok {
+			return v
+		}
+	}
+	return ch.get(hash)
+}
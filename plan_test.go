@@ -0,0 +1,52 @@
+package consistenthash
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestRemoveAndPlan(t *testing.T) {
+	hash := New(WithDefaultReplicas(20))
+	for i := 0; i < 10; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	keys := make([][]byte, 1000)
+	before := make(map[string][]byte, len(keys))
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key-%d", i))
+		before[string(keys[i])] = hash.Get(keys[i])
+	}
+
+	removed := []byte("node-3")
+	plan := hash.RemoveAndPlan(removed, keys)
+	if plan == nil {
+		t.Fatalf("expected a plan for removing %s", removed)
+	}
+	if _, _, ok := hash.identify(removed); ok {
+		t.Fatalf("expected %s to be removed", removed)
+	}
+	for _, key := range keys {
+		owner, planned := plan[string(key)]
+		if wasOnRemoved := bytes.Equal(before[string(key)], removed); planned != wasOnRemoved {
+			t.Fatalf("expected %s in the plan only if it was on %s, it was on %s", key, removed, before[string(key)])
+		}
+		if planned && !bytes.Equal(owner, hash.Get(key)) {
+			t.Errorf("expected %s to move to %s, planned %s", key, hash.Get(key), owner)
+		}
+	}
+	if len(plan) == 0 {
+		t.Errorf("expected some keys to move")
+	}
+
+	if plan := hash.RemoveAndPlan(removed, keys); plan != nil {
+		t.Errorf("expected no plan for a missing key, got %d entries", len(plan))
+	}
+
+	// the last item leaves nothing to move to
+	single := New()
+	single.Add([]byte("only"))
+	if plan := single.RemoveAndPlan([]byte("only"), keys[:2]); len(plan) != 2 || plan["key-0"] != nil {
+		t.Errorf("expected the keys to have no new item, got %q", plan)
+	}
+}
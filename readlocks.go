@@ -0,0 +1,28 @@
+package consistenthash
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// cacheLineSize size of the cache line the reader locks are padded to
+const cacheLineSize = 64
+
+// readLock a reader lock of WithShardedReadLocks, padded to a cache line so the reader counts of the locks
+// are not in the same cache line
+type readLock struct {
+	sync.RWMutex
+	_ [cacheLineSize - unsafe.Sizeof(sync.RWMutex{})]byte
+}
+
+// readLock takes the reader lock of the hash with WithShardedReadLocks, otherwise the read lock of the ring,
+// and returns the lock to release
+func (ch *ConsistentHash) readLock(hash uint32) *sync.RWMutex {
+	if ch.readLocks == nil {
+		ch.mu.RLock()
+		return &ch.mu
+	}
+	l := &ch.readLocks[hash%uint32(len(ch.readLocks))].RWMutex
+	l.RLock()
+	return l
+}
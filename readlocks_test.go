@@ -0,0 +1,49 @@
+package consistenthash
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestShardedReadLocks(t *testing.T) {
+	hash := New(WithDefaultReplicas(10), WithShardedReadLocks(8))
+	plain := New(WithDefaultReplicas(10))
+	for i := 0; i < 100; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+		plain.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		if !bytes.Equal(hash.Get(key), plain.Get(key)) {
+			t.Fatalf("expected the same item for %s, got %s and %s", key, hash.Get(key), plain.Get(key))
+		}
+	}
+
+	// readers of any lock are excluded by writers
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := []byte(fmt.Sprintf("node-%d", 100+g*500+i))
+				hash.Add(key)
+				if hash.Get(key) == nil || len(hash.GetN(key, 2)) != 2 {
+					t.Errorf("expected items for %s", key)
+					return
+				}
+				hash.Remove(key)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if err := hash.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if New(WithShardedReadLocks(1)).readLocks != nil {
+		t.Errorf("expected a single lock to be ignored")
+	}
+}
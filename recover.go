@@ -0,0 +1,18 @@
+package consistenthash
+
+// hashSafely hashes the key and returns false if the hash function panics with WithRecoverHashPanics,
+// otherwise the panic is not recovered. It must be called without holding the lock, as it writes the log
+func (ch *ConsistentHash) hashSafely(key []byte) (hash uint32, ok bool) {
+	if !ch.recoverHashPanics {
+		return ch.hash(key), true
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			if ch.logger != nil {
+				ch.logger("consistenthash: hash function panicked on %q: %v", key, r)
+			}
+			hash, ok = 0, false
+		}
+	}()
+	return ch.hash(key), true
+}
@@ -0,0 +1,126 @@
+package consistenthash
+
+import (
+	"bytes"
+	"testing"
+)
+
+// panickingHash panics on the keys starting with "bad"
+func panickingHash(key []byte) uint32 {
+	if bytes.HasPrefix(key, []byte("bad")) {
+		panic("malformed key")
+	}
+	return murmur32(key)
+}
+
+func TestRecoverHashPanics(t *testing.T) {
+	var logs int
+	hash := New(WithRecoverHashPanics(), WithHashFunc(panickingHash), WithLogger(func(format string, args ...any) {
+		logs++
+	}))
+	hash.Add([]byte("Bill"), []byte("bad-1"), []byte("Bob"))
+	hash.AddWeighted([]WeightedKey{{Key: []byte("bad-2"), Replicas: 3}, {Key: []byte("Alice"), Replicas: 3}})
+	if err := hash.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if logs == 0 {
+		t.Errorf("expected the panics to be logged")
+	}
+	if item := hash.Get([]byte("bad-key")); item != nil {
+		t.Errorf("expected nil for a key the hash function panics on, got %q", item)
+	}
+	if items := hash.GetN([]byte("bad-key"), 2); items != nil {
+		t.Errorf("expected nil for a key the hash function panics on, got %q", items)
+	}
+	bad := []byte("bad-key")
+	if item, exact := hash.GetExact(bad); item != nil || exact {
+		t.Errorf("expected nil from GetExact, got %q", item)
+	}
+	if n := hash.GetNInto(make([][]byte, 2), bad); n != 0 {
+		t.Errorf("expected no items from GetNInto, got %d", n)
+	}
+	if items := hash.GetSortedBatch([][]byte{[]byte("Bill"), bad}); items[0] == nil || items[1] != nil {
+		t.Errorf("expected nil from GetSortedBatch only for the bad key, got %q", items)
+	}
+	if item := hash.GetForAttempt(bad, 1); item != nil {
+		t.Errorf("expected nil from GetForAttempt, got %q", item)
+	}
+	if item := hash.GetOther(bad); item != nil {
+		t.Errorf("expected nil from GetOther, got %q", item)
+	}
+	if items := hash.GetNFiltered(bad, 2, nil); items != nil {
+		t.Errorf("expected nil from GetNFiltered, got %q", items)
+	}
+	if items := hash.ReplicaList(bad, 2); items != nil {
+		t.Errorf("expected nil from ReplicaList, got %q", items)
+	}
+	if primary, standbys := hash.GetTiered(bad); primary != nil || standbys != nil {
+		t.Errorf("expected nil from GetTiered, got %q %q", primary, standbys)
+	}
+	if items := hash.GetNWeighted(bad, 2); items != nil {
+		t.Errorf("expected nil from GetNWeighted, got %q", items)
+	}
+	if trace := hash.LookupTrace(bad); trace.Found {
+		t.Errorf("expected nothing found by LookupTrace, got %+v", trace)
+	}
+	if share, partition := hash.ArcShare(bad), hash.Partition(bad, 4); share != 0 || partition != 0 {
+		t.Errorf("expected no share and partition 0, got %f and %d", share, partition)
+	}
+	bounded := New(WithRecoverHashPanics(), WithHashFunc(panickingHash), WithBoundedLoad(1.25))
+	bounded.Add([]byte("Bill"))
+	if item, release := bounded.Acquire(bad); item != nil {
+		t.Errorf("expected nil from Acquire, got %q", item)
+	} else {
+		release()
+	}
+	for _, key := range []string{"Bill", "Bob", "Alice"} {
+		if item := hash.GetString(key); item != key {
+			t.Errorf("expected %q to be added, got %q", key, item)
+		}
+	}
+}
+
+func TestHashPanicReleasesLock(t *testing.T) {
+	hash := New(WithHashFunc(panickingHash))
+	hash.Add([]byte("Bill"))
+
+	for _, op := range []func(){
+		func() { hash.Add([]byte("bad-1")) },
+		func() { hash.Get([]byte("bad-key")) },
+		func() { hash.Remove([]byte("bad-1")) },
+		func() { hash.DrainNode([]byte("bad-1"), 0) },
+		func() { hash.RemoveIfUnderloaded([]byte("bad-1"), 1) },
+		func() { hash.AddTiered(1, 1, []byte("bad-1")) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected the hash function to panic")
+				}
+			}()
+			op()
+		}()
+
+		// the lock is released, so the ring is still usable
+		hash.Add([]byte("Bob"))
+		if item := hash.Get([]byte("key")); item == nil {
+			t.Fatalf("expected an item after the panic")
+		}
+		hash.Remove([]byte("Bob"))
+	}
+}
+
+func TestRecoverHashPanicsLogsUnlocked(t *testing.T) {
+	// the logger changes the ring, so it would deadlock if it was called while holding the lock
+	var hash *ConsistentHash
+	hash = New(WithRecoverHashPanics(), WithHashFunc(panickingHash), WithLogger(func(format string, args ...any) {
+		hash.Add([]byte("Carol"))
+	}))
+	hash.Add([]byte("Bill"))
+	if items := hash.GetSortedBatch([][]byte{[]byte("Bill"), []byte("bad-key")}); items[0] == nil || items[1] != nil {
+		t.Errorf("expected nil from GetSortedBatch only for the bad key, got %q", items)
+	}
+	if item := hash.GetString("Carol"); item != "Carol" {
+		t.Errorf("expected the logger to add Carol, got %s", item)
+	}
+}
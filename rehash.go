@@ -0,0 +1,102 @@
+package consistenthash
+
+import (
+	"bytes"
+	"sort"
+	"time"
+)
+
+// Rehash moves the replicas of the key to new positions in the circle, keeping the key and its number of replicas
+// each call increments the salt of the key, so the new positions are the same on every ring rehashing the key as many times.
+// The original position of the key doesn't change, so a key without replicas is not moved. It returns false if the key doesn't exist
+func (ch *ConsistentHash) Rehash(key []byte) bool {
+	ch.lock()
+	defer ch.unlock()
+	originalHash, existing, ok := ch.identify(key)
+	if !ok || !bytes.Equal(existing, key) {
+		return false
+	}
+	replicas := ch.replicasOf(originalHash)
+	salt := ch.salts[originalHash]
+	for _, n := range ch.appendSalted(make([]node, 0, nodesCap(1, replicas)), originalHash, key, replicas, salt)[1:] {
+		ch.remove(n.key, n.pointer)
+	}
+	if ch.salts == nil {
+		ch.salts = make(map[uint32]uint32)
+	}
+	ch.salts[originalHash] = salt + 1
+	ch.addNodes(ch.appendSalted(make([]node, 0, nodesCap(1, replicas)), originalHash, key, replicas, salt+1)[1:])
+	return true
+}
+
+// RehashAll swaps the hash function of the ring and moves all the items to their positions by the new hash,
+// keeping the items, their number of replicas, tiers and ages. All the positions change, so most keys are routed to other
+// items afterwards, which is expected while migrating to another hash function. The salts of the rehashed keys (Rehash)
+// are reset, the pinned keys are unpinned and WithResultCache stops caching, as they depend on the old hash
+func (ch *ConsistentHash) RehashAll(newHash HashFunc) {
+	if newHash == nil {
+		return
+	}
+	ch.lock()
+	defer ch.unlock()
+
+	type member struct {
+		key      []byte
+		replicas uint
+		tier     int
+		addedAt  time.Time
+	}
+	members := make([]member, 0, len(ch.hashMap))
+	for originalHash, key := range ch.hashMap {
+		members = append(members, member{
+			key:      key,
+			replicas: ch.replicasOf(originalHash),
+			tier:     ch.tiers[originalHash],
+			addedAt:  ch.addedAt[originalHash],
+		})
+	}
+	// sorted, so the colliding keys are chained the same on every ring
+	sort.Slice(members, func(i, j int) bool {
+		return bytes.Compare(members[i].key, members[j].key) < 0
+	})
+
+	// hashed before changing the ring, so a panicking hash function leaves the ring as it was
+	hashes := make([]uint32, len(members))
+	for i, m := range members {
+		hashes[i] = newHash(m.key)
+		if ch.chains != nil {
+			// the secondary hash of a colliding key
+			newHash(reverse(m.key))
+		}
+	}
+
+	ch.logf("consistenthash: rehashing %d keys with a new hash function", len(members))
+	ch.hashFunc.Store(newHash)
+	ch.hashMap = make(map[uint32][]byte, len(members))
+	ch.replicaMap = make(map[uint32]uint)
+	ch.salts = nil
+	ch.pins = nil
+	ch.cache = nil
+	if ch.chains != nil {
+		ch.chains = make(map[uint32][]uint32)
+	}
+	if ch.tiers != nil {
+		ch.tiers = make(map[uint32]int)
+	}
+	if ch.addedAt != nil {
+		ch.addedAt = make(map[uint32]time.Time, len(members))
+	}
+	// the members don't change, so storing them again is not reported as added
+	ch.muted = true
+	defer func() { ch.muted = false }()
+	for i, m := range members {
+		hash := ch.storeKey(ch.fold(hashes[i]), m.key, m.replicas)
+		if m.tier > 0 {
+			ch.tiers[hash] = m.tier
+		}
+		if ch.addedAt != nil {
+			ch.addedAt[hash] = m.addedAt
+		}
+	}
+	ch.rebuild()
+}
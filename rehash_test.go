@@ -0,0 +1,147 @@
+package consistenthash
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestRehash(t *testing.T) {
+	hash := New(WithDefaultReplicas(10))
+	for i := 0; i < 10; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	before := positionsOf(hash, "node-3")
+
+	if !hash.Rehash([]byte("node-3")) {
+		t.Fatalf("expected the key to be rehashed")
+	}
+	after := positionsOf(hash, "node-3")
+	if len(after) != len(before) || reflect.DeepEqual(before, after) {
+		t.Fatalf("expected %d new positions, got %v from %v", len(before), after, before)
+	}
+	if err := hash.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if hash.GetString("node-3") != "node-3" {
+		t.Errorf("expected the key to be reachable on its original position")
+	}
+
+	// the same number of rehashes moves the key to the same positions
+	other := New(WithDefaultReplicas(10))
+	for i := 9; i >= 0; i-- {
+		other.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	other.Rehash([]byte("node-3"))
+	if hash.Fingerprint() != other.Fingerprint() {
+		t.Errorf("expected the same positions after the same rehash")
+	}
+
+	// adding again and removing use the moved positions
+	hash.Add([]byte("node-3"))
+	hash.AddWeighted([]WeightedKey{{Key: []byte("node-3"), Replicas: 10}})
+	if !reflect.DeepEqual(positionsOf(hash, "node-3"), after) {
+		t.Errorf("expected adding again to keep the moved positions")
+	}
+	hash.Remove([]byte("node-3"))
+	if err := hash.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if positions := positionsOf(hash, "node-3"); len(positions) != 0 {
+		t.Errorf("expected all the positions to be removed, got %v", positions)
+	}
+
+	if hash.Rehash([]byte("node-3")) {
+		t.Errorf("expected a missing key not to be rehashed")
+	}
+}
+
+func TestRehashAll(t *testing.T) {
+	hash := New(WithDefaultReplicas(10), WithEventBuffer(100, false))
+	for i := 0; i < 10; i++ {
+		hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	hash.AddReplicas(3, []byte("small"))
+	hash.Rehash([]byte("node-3"))
+	digest := hash.MembershipDigest()
+	for len(hash.Events()) > 0 {
+		<-hash.Events()
+	}
+	before := positionsOf(hash, "node-1")
+
+	hash.RehashAll(murmur32)
+	if hash.MembershipDigest() != digest {
+		t.Errorf("expected the members and their replicas to be kept")
+	}
+	if after := positionsOf(hash, "node-1"); reflect.DeepEqual(before, after) {
+		t.Errorf("expected the positions to change, got %v", after)
+	}
+	if err := hash.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(hash.Events()); n != 0 {
+		t.Errorf("expected no events for the kept members, got %d", n)
+	}
+
+	// the ring is the same as a ring built with the new hash function
+	expected := New(WithDefaultReplicas(10), WithMurmur32())
+	for i := 0; i < 10; i++ {
+		expected.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	expected.AddReplicas(3, []byte("small"))
+	if hash.Fingerprint() != expected.Fingerprint() {
+		t.Errorf("expected the same positions as a ring using the new hash function")
+	}
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		if got, want := hash.GetString(string(key)), expected.GetString(string(key)); got != want {
+			t.Fatalf("expected %q for %q, got %q", want, key, got)
+		}
+	}
+}
+
+// positionsOf returns the sorted positions of the key in the circle
+func positionsOf(hash *ConsistentHash, key string) []uint32 {
+	originalHash := hash.HashKey([]byte(key))
+	hash.mu.RLock()
+	defer hash.mu.RUnlock()
+	var positions []uint32
+	for _, nodes := range hash.blocks {
+		for _, n := range nodes {
+			if n.pointer == originalHash {
+				positions = append(positions, n.key)
+			}
+		}
+	}
+	return positions
+}
+
+func TestRehashAllPanicKeepsRing(t *testing.T) {
+	hash := New(WithDefaultReplicas(10), WithEventBuffer(100, false), WithCollisionChaining())
+	hash.Add([]byte("Bill"), []byte("bad-1"))
+	fingerprint := hash.Fingerprint()
+	for len(hash.Events()) > 0 {
+		<-hash.Events()
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected the new hash function to panic")
+			}
+		}()
+		hash.RehashAll(panickingHash)
+	}()
+	if hash.Fingerprint() != fingerprint {
+		t.Errorf("expected the ring not to change")
+	}
+	if item := hash.GetString("Bill"); item != "Bill" {
+		t.Errorf("expected the old hash function to be kept, got %s", item)
+	}
+
+	// the events are still sent
+	hash.Add([]byte("Bob"))
+	if n := len(hash.Events()); n != 1 {
+		t.Errorf("expected an event for Bob, got %d", n)
+	}
+}
@@ -0,0 +1,16 @@
+package consistenthash
+
+// Ring the operations shared by the rings, so callers can switch between them
+type Ring interface {
+	Add(keys ...[]byte)
+	AddReplicas(replicas uint, keys ...[]byte)
+	Get(key []byte) []byte
+	GetString(key string) string
+	Remove(key []byte) bool
+	IsEmpty() bool
+}
+
+var (
+	_ Ring = (*ConsistentHash)(nil)
+	_ Ring = (*ShardedRing)(nil)
+)
@@ -0,0 +1,37 @@
+package consistenthash
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	rings := map[string]Ring{
+		"ConsistentHash": New(WithDefaultReplicas(10)),
+		"ShardedRing":    NewSharded(4, WithDefaultReplicas(10)),
+	}
+	for name, ring := range rings {
+		if !ring.IsEmpty() || ring.Get([]byte("key")) != nil || ring.GetString("key") != "" {
+			t.Fatalf("%s: expected an empty ring", name)
+		}
+		ring.Add([]byte("node-1"), []byte("node-2"))
+		ring.AddReplicas(100, []byte("node-3"))
+		if ring.IsEmpty() {
+			t.Fatalf("%s: expected items in the ring", name)
+		}
+		for i := 0; i < 100; i++ {
+			key := fmt.Sprintf("key-%d", i)
+			if got, want := ring.GetString(key), string(ring.Get([]byte(key))); got == "" || got != want {
+				t.Fatalf("%s: expected GetString to match Get %q, got %q", name, want, got)
+			}
+		}
+		for _, key := range []string{"node-1", "node-2", "node-3"} {
+			if !ring.Remove([]byte(key)) {
+				t.Errorf("%s: expected %s to be removed", name, key)
+			}
+		}
+		if !ring.IsEmpty() {
+			t.Errorf("%s: expected an empty ring after removing all items", name)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package consistenthash
+
+// fold folds the hash into the circle of the ring size (WithRingSize)
+func (ch *ConsistentHash) fold(hash uint32) uint32 {
+	return fold(hash, ch.ringSize)
+}
+
+// fold folds the hash into a circle of the given size
+func fold(hash uint32, size uint64) uint32 {
+	if size == ringSize {
+		return hash
+	}
+	return uint32(uint64(hash) % size)
+}
+
+// blockNumberOf returns the block number of the hash when the circle of the ring size is divided into totalBlocks equal blocks
+func (ch *ConsistentHash) blockNumberOf(hash, totalBlocks uint32) uint32 {
+	if ch.ringSize == ringSize || totalBlocks < 2 {
+		return blockOf(hash, totalBlocks)
+	}
+	return uint32(uint64(hash) * uint64(totalBlocks) / ch.ringSize)
+}
+
+// arcOf returns the clockwise distance from one position to another in a circle of the given size
+func arcOf(from, to uint32, size uint64) uint64 {
+	if to >= from {
+		return uint64(to - from)
+	}
+	return size - uint64(from-to)
+}
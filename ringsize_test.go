@@ -0,0 +1,76 @@
+package consistenthash
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"testing"
+)
+
+func TestRingSize(t *testing.T) {
+	for _, size := range []uint64{1 << 14, 1000} {
+		for _, opts := range [][]Option{
+			{WithDefaultReplicas(20), WithRingSize(size)},
+			{WithDefaultReplicas(20), WithRingSize(size), WithReplicaJitter(7), WithBlockPartitioning(2)},
+			{WithMultiProbe(4), WithRingSize(size)},
+		} {
+			hash := New(opts...)
+			for i := 0; i < 20; i++ {
+				hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+			}
+			if err := hash.Validate(); err != nil {
+				t.Fatal(err)
+			}
+
+			positions, table := hash.Snapshot()
+			for _, position := range positions {
+				if uint64(position) >= size {
+					t.Fatalf("expected the positions to be less than %d, got %d", size, position)
+				}
+			}
+			if !sort.SliceIsSorted(positions, func(i, j int) bool { return positions[i] < positions[j] }) {
+				t.Fatalf("expected the positions to be sorted")
+			}
+
+			view := hash.SnapshotView()
+			for i := 0; i < 2000; i++ {
+				key := []byte(fmt.Sprintf("key-%d", i))
+				h := hash.HashKey(key)
+				if uint64(h) >= size {
+					t.Fatalf("expected the hash to be less than %d, got %d", size, h)
+				}
+				if _, ok := table[h]; ok {
+					// Get returns the item of the exact hash, even if its position is taken by another item
+					continue
+				}
+				if item, expected := hash.Get(key), view.Get(key); !bytes.Equal(item, expected) {
+					t.Fatalf("expected the view to route %q to %q, got %q", key, item, expected)
+				}
+				if hash.multiProbe > 0 {
+					continue
+				}
+				// the closest position clockwise, or the first one after the last position
+				idx := sort.Search(len(positions), func(i int) bool { return positions[i] >= h })
+				if idx == len(positions) {
+					idx = 0
+				}
+				owner := hash.OwnerOfPosition(positions[idx])
+				if item := hash.Get(key); !bytes.Equal(item, owner) {
+					t.Fatalf("expected %q for hash %d, got %q", owner, h, item)
+				}
+			}
+
+			var total float64
+			for _, share := range view.Shares() {
+				total += share
+			}
+			if math.Abs(total-1) > 1e-9 {
+				t.Errorf("expected the shares of the ring size to add up to 1, got %f", total)
+			}
+			if len(table) != 20 {
+				t.Errorf("expected 20 items, got %d", len(table))
+			}
+		}
+	}
+}
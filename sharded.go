@@ -0,0 +1,107 @@
+package consistenthash
+
+// ShardedRing partitions the items over independent rings, so adding and removing items only locks the ring
+// of their shard. Items and keys are assigned to the shards by a jump consistent hash, and a key is routed
+// to the closest item in its shard, or in the next shard which has items if its shard is empty.
+// Changing the number of shards moves about 1/P of the items, it's not a drop-in replacement of a single ring
+// as the keys are routed only among the items of one shard
+type ShardedRing struct {
+	shards []*ConsistentHash
+}
+
+// NewSharded makes a ShardedRing of the given number of rings, each made by New with the given options
+func NewSharded(shards int, opts ...Option) *ShardedRing {
+	if shards < 1 {
+		shards = 1
+	}
+	s := &ShardedRing{shards: make([]*ConsistentHash, shards)}
+	for i := range s.shards {
+		s.shards[i] = New(opts...)
+	}
+	return s
+}
+
+// Shards returns the number of shards
+func (s *ShardedRing) Shards() int {
+	return len(s.shards)
+}
+
+// Add adds the items to the rings of their shards
+func (s *ShardedRing) Add(keys ...[]byte) {
+	s.add(keys, func(ch *ConsistentHash, keys [][]byte) {
+		ch.Add(keys...)
+	})
+}
+
+// AddReplicas adds the items with the given number of replicas to the rings of their shards
+func (s *ShardedRing) AddReplicas(replicas uint, keys ...[]byte) {
+	s.add(keys, func(ch *ConsistentHash, keys [][]byte) {
+		ch.AddReplicas(replicas, keys...)
+	})
+}
+
+// add groups the items by shard and adds each group to the ring of its shard by the given function
+func (s *ShardedRing) add(keys [][]byte, addTo func(ch *ConsistentHash, keys [][]byte)) {
+	if len(keys) == 1 {
+		addTo(s.shards[s.shardOf(keys[0])], keys)
+		return
+	}
+	grouped := make([][][]byte, len(s.shards))
+	for _, key := range keys {
+		shard := s.shardOf(key)
+		grouped[shard] = append(grouped[shard], key)
+	}
+	for shard, keys := range grouped {
+		if len(keys) > 0 {
+			addTo(s.shards[shard], keys)
+		}
+	}
+}
+
+// Remove removes the item from the ring of its shard
+func (s *ShardedRing) Remove(key []byte) bool {
+	return s.shards[s.shardOf(key)].Remove(key)
+}
+
+// Get finds the closest item to the key in its shard, or in the next shard which has items if its shard is empty
+func (s *ShardedRing) Get(key []byte) []byte {
+	shard := s.shardOf(key)
+	for i := range s.shards {
+		if item := s.shards[(shard+i)%len(s.shards)].Get(key); item != nil {
+			return item
+		}
+	}
+	return nil
+}
+
+// GetString finds the closest item to the key like Get, it returns "" if there is no item
+func (s *ShardedRing) GetString(key string) string {
+	return string(s.Get([]byte(s.shards[0].normalize(key))))
+}
+
+// IsEmpty returns true if none of the shards has items
+func (s *ShardedRing) IsEmpty() bool {
+	for _, shard := range s.shards {
+		if !shard.IsEmpty() {
+			return false
+		}
+	}
+	return true
+}
+
+// shardOf returns the shard of the key, the hash is mixed as the rings use the same hash for the positions
+func (s *ShardedRing) shardOf(key []byte) int {
+	return jumpHash(uint64(fmix32(s.shards[0].hash(key))), len(s.shards))
+}
+
+// jumpHash maps the key to one of the buckets, so changing the number of buckets moves the least number of keys
+// (Lamping and Veach, A Fast, Minimal Memory, Consistent Hash Algorithm)
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
@@ -0,0 +1,91 @@
+package consistenthash
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func TestShardedRing(t *testing.T) {
+	ring := NewSharded(4, WithDefaultReplicas(10))
+	if !ring.IsEmpty() || ring.Get([]byte("key")) != nil {
+		t.Fatalf("expected an empty ring")
+	}
+	for i := 0; i < 100; i++ {
+		ring.Add([]byte(fmt.Sprintf("node-%d", i)))
+	}
+	ring.Add([]byte("node-100"), []byte("node-101"))
+
+	// every item is in exactly one shard
+	seen := make(map[string]int)
+	for shard, hash := range ring.shards {
+		if hash.IsEmpty() {
+			t.Errorf("expected shard %d to have items", shard)
+		}
+		for _, key := range hash.hashMap {
+			if previous, ok := seen[string(key)]; ok {
+				t.Errorf("expected %q to be in one shard, found in %d and %d", key, previous, shard)
+			}
+			seen[string(key)] = shard
+		}
+	}
+	if len(seen) != 102 {
+		t.Errorf("expected 102 items, got %d", len(seen))
+	}
+
+	// keys are routed to the items of their shard
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		item := ring.Get(key)
+		if shard := ring.shardOf(key); seen[string(item)] != shard {
+			t.Fatalf("expected %q to be routed to shard %d, got %q in shard %d", key, shard, item, seen[string(item)])
+		}
+	}
+
+	if !ring.Remove([]byte("node-1")) || ring.Remove([]byte("node-1")) {
+		t.Errorf("expected node-1 to be removed once")
+	}
+
+	// keys of an empty shard are routed to the next shard
+	single := NewSharded(8)
+	single.Add([]byte("Bill"))
+	for i := 0; i < 100; i++ {
+		if item := single.Get([]byte(fmt.Sprintf("key-%d", i))); string(item) != "Bill" {
+			t.Fatalf("expected Bill, got %q", item)
+		}
+	}
+}
+
+func TestJumpHash(t *testing.T) {
+	// adding a bucket only moves keys to the new bucket, about 1/buckets of them
+	var moved int
+	for i := uint64(0); i < 10000; i++ {
+		before, after := jumpHash(i, 4), jumpHash(i, 5)
+		if before != after {
+			if after != 4 {
+				t.Fatalf("expected key %d to move to the new bucket, got %d", i, after)
+			}
+			moved++
+		}
+	}
+	if moved < 1500 || moved > 2500 {
+		t.Errorf("expected about 2000 of 10000 keys to move, got %d", moved)
+	}
+	if bucket := jumpHash(42, 1); bucket != 0 {
+		t.Errorf("expected the only bucket, got %d", bucket)
+	}
+}
+
+func BenchmarkConcurrentAdd(b *testing.B) {
+	for _, shards := range []int{1, 16} {
+		b.Run(fmt.Sprintf("Shards%d", shards), func(b *testing.B) {
+			ring := NewSharded(shards, WithDefaultReplicas(10))
+			var counter uint64
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					ring.Add([]byte(fmt.Sprintf("node-%d", atomic.AddUint64(&counter, 1))))
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package consistenthash
+
+import (
+	"bytes"
+	"hash/crc32"
+	"sync"
+)
+
+// SharedConfig configuration shared by many rings, like one ring per tenant
+// the rings made from it use the same hash function and reuse the same buffers
+type SharedConfig struct {
+	hash    HashFunc
+	buffers sync.Pool
+}
+
+// NewSharedConfig makes a shared configuration with the given hash function, nil uses the default crc32
+func NewSharedConfig(hash HashFunc) *SharedConfig {
+	if hash == nil {
+		hash = crc32.ChecksumIEEE
+	}
+	return &SharedConfig{
+		hash:    hash,
+		buffers: sync.Pool{New: func() any { return new(bytes.Buffer) }},
+	}
+}
+
+// NewWithShared makes new ConsistentHash using the shared configuration, the hash function of the shared configuration
+// is used even if the options have another one
+func NewWithShared(shared *SharedConfig, opts ...Option) *ConsistentHash {
+	return New(append(opts, func(o *options) {
+		o.shared = shared
+	})...)
+}
@@ -0,0 +1,29 @@
+package consistenthash
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNewWithShared(t *testing.T) {
+	shared := NewSharedConfig(murmur32)
+	rings := make([]*ConsistentHash, 100)
+	for i := range rings {
+		rings[i] = NewWithShared(shared, WithDefaultReplicas(10), WithHashFunc(func(data []byte) uint32 { return 0 }))
+		rings[i].Add([]byte(fmt.Sprintf("tenant-%d-a", i)), []byte(fmt.Sprintf("tenant-%d-b", i)))
+	}
+
+	for i, ring := range rings {
+		if ring.buffers != &shared.buffers {
+			t.Fatalf("expected ring %d to use the shared buffers", i)
+		}
+		expected := New(WithDefaultReplicas(10), WithMurmur32())
+		expected.Add([]byte(fmt.Sprintf("tenant-%d-a", i)), []byte(fmt.Sprintf("tenant-%d-b", i)))
+		for j := 0; j < 20; j++ {
+			key := fmt.Sprintf("key-%d", j)
+			if ring.GetString(key) != expected.GetString(key) {
+				t.Errorf("Asking for %s in ring %d, should have yielded %s, got %s", key, i, expected.GetString(key), ring.GetString(key))
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package consistenthash
+
+import "math/bits"
+
+// markOccupied sets or clears the bit of the block in the bitmap of the occupied blocks
+func (ch *ConsistentHash) markOccupied(blockNumber uint32, occupied bool) {
+	if occupied {
+		ch.occupied[blockNumber>>6] |= 1 << (blockNumber & 63)
+		return
+	}
+	ch.occupied[blockNumber>>6] &^= 1 << (blockNumber & 63)
+}
+
+// resetOccupied rebuilds the bitmap of the occupied blocks after the blocks are replaced
+func (ch *ConsistentHash) resetOccupied() {
+	words := int(ch.totalBlocks+63) >> 6
+	if cap(ch.occupied) < words {
+		ch.occupied = make([]uint64, words)
+	}
+	ch.occupied = ch.occupied[:words]
+	for i := range ch.occupied {
+		ch.occupied[i] = 0
+	}
+	for blockNumber := uint32(0); blockNumber < ch.totalBlocks; blockNumber++ {
+		if len(ch.blocks[blockNumber]) > 0 {
+			ch.markOccupied(blockNumber, true)
+		}
+	}
+}
+
+// nextOccupied returns the first block from the given block number that has a key, skipping 64 empty blocks
+// at a time, returns the total number of blocks if there is none
+func (ch *ConsistentHash) nextOccupied(blockNumber uint32) uint32 {
+	if blockNumber >= ch.totalBlocks {
+		return ch.totalBlocks
+	}
+	i := int(blockNumber >> 6)
+	word := ch.occupied[i] &^ (1<<(blockNumber&63) - 1) // ignore the blocks before the given one
+	for word == 0 {
+		i++
+		if i == len(ch.occupied) {
+			return ch.totalBlocks
+		}
+		word = ch.occupied[i]
+	}
+	return uint32(i)<<6 + uint32(bits.TrailingZeros64(word))
+}
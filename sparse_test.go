@@ -0,0 +1,62 @@
+package consistenthash
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// sparseHash puts all the keys in the first 1/256 of the circle, so most of the blocks are empty
+func sparseHash(key []byte) uint32 {
+	return murmur32(key) >> 8
+}
+
+func TestMaxProbeBlocks(t *testing.T) {
+	for _, probes := range []int{1, 2, 100} {
+		hash := New(WithMaxProbeBlocks(probes), WithBlockPartitioning(1), WithHashFunc(sparseHash))
+		reference := New(WithBlockPartitioning(1), WithHashFunc(sparseHash))
+		for i := 0; i < 200; i++ {
+			key := []byte(fmt.Sprintf("node-%d", i))
+			hash.Add(key)
+			reference.Add(key)
+		}
+		// removing keys empties some of the occupied blocks
+		for i := 0; i < 200; i += 3 {
+			key := []byte(fmt.Sprintf("node-%d", i))
+			hash.Remove(key)
+			reference.Remove(key)
+		}
+
+		for i := 0; i < 10000; i++ {
+			key := []byte(fmt.Sprintf("key-%d", i))
+			// hash the keys normally, so they are spread over the empty blocks too
+			h := murmur32(key)
+			if expected, got := reference.GetByHashHint(h), hash.GetByHashHint(h); !bytes.Equal(expected, got) {
+				t.Fatalf("expected %q for hash %d with %d probes, got %q", expected, h, probes, got)
+			}
+		}
+	}
+
+	if got := New(WithMaxProbeBlocks(1)).Get([]byte("key")); got != nil {
+		t.Errorf("expected nil from an empty ring, got %q", got)
+	}
+}
+
+func BenchmarkSparseLookup(b *testing.B) {
+	for _, probes := range []int{0, 8} {
+		b.Run(fmt.Sprintf("MaxProbeBlocks%d", probes), func(b *testing.B) {
+			hash := New(WithMaxProbeBlocks(probes), WithBlockPartitioning(1), WithHashFunc(sparseHash))
+			for i := 0; i < 10000; i++ {
+				hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+			}
+			keys := make([]uint32, 1024)
+			for i := range keys {
+				keys[i] = murmur32([]byte(fmt.Sprintf("key-%d", i)))
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				hash.GetByHashHint(keys[i%len(keys)])
+			}
+		})
+	}
+}
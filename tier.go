@@ -0,0 +1,92 @@
+package consistenthash
+
+import "sort"
+
+// AddTiered adds keys with the given number of replicas in a tier, GetTiered returns the closest item of tier 0
+// as the primary and the closest item of each higher tier as the standbys, keys added by Add are in tier 0
+// the tier of a key stays until it's removed or added again by AddTiered, nothing is added if it exceeds the capacity (WithCapacity)
+func (ch *ConsistentHash) AddTiered(tier int, replicas uint, keys ...[]byte) {
+	if replicas < 1 {
+		return
+	}
+	replicas = ch.clampReplicas(replicas)
+	keys = ch.filterKeys(keys)
+	nodes := make([]node, 0, nodesCap(len(keys), replicas))
+	for idx := range keys {
+		nodes = ch.appendNodes(nodes, keys[idx], replicas)
+	}
+
+	ch.lock()
+	defer ch.unlock()
+	if !ch.fits(ch.keysGrowth(keys, nodes, replicas)) {
+		return
+	}
+	ch.addKeys(replicas, keys, nodes)
+	for _, key := range keys {
+		originalHash, _, _ := ch.identify(key)
+		if tier == 0 {
+			delete(ch.tiers, originalHash)
+			continue
+		}
+		if ch.tiers == nil {
+			ch.tiers = make(map[uint32]int)
+		}
+		ch.tiers[originalHash] = tier
+	}
+	ch.scaleReplicas()
+}
+
+// GetTiered finds the closest item of tier 0 to the key as the primary, and the closest item of each higher tier
+// as the standbys ordered by their tier, the primary is nil if there is no item in tier 0
+func (ch *ConsistentHash) GetTiered(key []byte) (primary []byte, standbys [][]byte) {
+	if !ch.allowEmptyKeys && len(key) == 0 {
+		return nil, nil
+	}
+
+	hash, ok := ch.hashSafely(key)
+	if !ok {
+		return nil, nil
+	}
+
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	if ch.totalKeys == 0 {
+		return nil, nil
+	}
+
+	found := make(map[int][]byte)
+	remaining := ch.tierCount()
+	ch.walk(hash, func(blockNumber uint32, idx int) bool {
+		tier := ch.tiers[ch.blocks[blockNumber][idx].pointer]
+		if _, ok := found[tier]; !ok {
+			found[tier] = ch.valueOf(blockNumber, idx)
+			remaining--
+		}
+		return remaining > 0
+	})
+
+	tiers := make([]int, 0, len(found))
+	for tier := range found {
+		if tier > 0 {
+			tiers = append(tiers, tier)
+		}
+	}
+	sort.Ints(tiers)
+	for _, tier := range tiers {
+		standbys = append(standbys, found[tier])
+	}
+	return found[0], standbys
+}
+
+// tierCount returns the number of tiers with at least one item, the lock must be held
+func (ch *ConsistentHash) tierCount() int {
+	if len(ch.tiers) == 0 {
+		return 1
+	}
+	counts := make(map[int]bool)
+	for originalHash := range ch.hashMap {
+		counts[ch.tiers[originalHash]] = true
+	}
+	return len(counts)
+}
@@ -0,0 +1,47 @@
+package consistenthash
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTiers(t *testing.T) {
+	hash := New()
+	hash.AddTiered(0, 20, []byte("primary-1"), []byte("primary-2"))
+	hash.AddTiered(1, 20, []byte("standby-1"), []byte("standby-2"))
+
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		primary, standbys := hash.GetTiered(key)
+		if string(primary) != "primary-1" && string(primary) != "primary-2" {
+			t.Fatalf("expected a primary of tier 0 for %s, got %s", key, primary)
+		}
+		if len(standbys) != 1 || (string(standbys[0]) != "standby-1" && string(standbys[0]) != "standby-2") {
+			t.Fatalf("expected a standby of tier 1 for %s, got %q", key, standbys)
+		}
+	}
+
+	// Get doesn't care about the tiers
+	found := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		found[hash.GetString(fmt.Sprintf("key-%d", i))] = true
+	}
+	if !found["standby-1"] || !found["standby-2"] {
+		t.Errorf("expected the standbys to be returned by Get as well, got %v", found)
+	}
+
+	// adding to tier 0 again makes it a primary
+	hash.AddTiered(0, 20, []byte("standby-1"))
+	hash.Remove([]byte("standby-2"))
+	hash.AddTiered(2, 20, []byte("backup"))
+	for i := 0; i < 100; i++ {
+		primary, standbys := hash.GetTiered([]byte(fmt.Sprintf("key-%d", i)))
+		if primary == nil || len(standbys) != 1 || string(standbys[0]) != "backup" {
+			t.Fatalf("expected a primary and the backup, got %s %q", primary, standbys)
+		}
+	}
+
+	if primary, standbys := New().GetTiered([]byte("key")); primary != nil || standbys != nil {
+		t.Errorf("expected nothing from an empty ring")
+	}
+}
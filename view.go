@@ -0,0 +1,197 @@
+package consistenthash
+
+import (
+	"bytes"
+	"sort"
+	"time"
+)
+
+// RingView a read-only copy of the ring taken by SnapshotView, later changes of the ring don't affect it
+// so several queries on the same view always agree, it's safe for concurrent use and doesn't need to be released
+type RingView struct {
+	hash           HashFunc
+	multiProbe     int
+	ringSize       uint64
+	allowEmptyKeys bool
+	replicaJitter  bool
+	jitterSeed     uint32
+	nodeHasher     func(key []byte, index uint32) uint32
+	nodes          []node            // all the positions in the circle, sorted
+	items          map[uint32][]byte // items by their hash
+
+	// needed to change a ring made by NewFromSnapshot the same way as the original ring
+	replicas map[uint32]uint     // number of replicas of the items by their hash
+	salts    map[uint32]uint32   // salts of the rehashed items (Rehash)
+	chains   map[uint32][]uint32 // hashes of the chained items by their own hash (WithCollisionChaining)
+}
+
+// SnapshotView returns a consistent read-only copy of the ring, holding the read lock only while copying
+// the items share the memory of the ring like Get, so they must not be changed
+func (ch *ConsistentHash) SnapshotView() *RingView {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	v := &RingView{
+		hash:           ch.hashFunc.Load().(HashFunc),
+		multiProbe:     ch.multiProbe,
+		ringSize:       ch.ringSize,
+		allowEmptyKeys: ch.allowEmptyKeys,
+		replicaJitter:  ch.replicaJitter,
+		jitterSeed:     ch.jitterSeed,
+		nodeHasher:     ch.nodeHasher,
+		nodes:          make([]node, 0, ch.totalKeys),
+		items:          make(map[uint32][]byte, len(ch.hashMap)),
+		replicas:       make(map[uint32]uint, len(ch.hashMap)),
+		salts:          make(map[uint32]uint32, len(ch.salts)),
+		chains:         make(map[uint32][]uint32, len(ch.chains)),
+	}
+	for blockNumber := uint32(0); blockNumber < ch.totalBlocks; blockNumber++ {
+		v.nodes = append(v.nodes, ch.blocks[blockNumber]...)
+	}
+	for originalHash, item := range ch.hashMap {
+		v.items[originalHash] = item
+		v.replicas[originalHash] = ch.replicasOf(originalHash)
+	}
+	for originalHash, salt := range ch.salts {
+		v.salts[originalHash] = salt
+	}
+	for originalHash, chain := range ch.chains {
+		v.chains[originalHash] = append([]uint32(nil), chain...)
+	}
+	return v
+}
+
+// NewFromSnapshot makes a ring with the items and positions of the view without hashing them, which routes every key
+// to the same item as the ring of the view. The hash function, node hasher, ring size, multi-probe, replica jitter
+// and empty keys setting of the view are used instead of the options, so the ring changes like the original ring. Tiers, pins and ages of the items are not copied
+// the ring is empty if the positions of the view exceed the capacity (WithCapacity), WithMembers is ignored
+func NewFromSnapshot(v *RingView, opts ...Option) *ConsistentHash {
+	// the cached keys are hashed by the hash function of the view
+	var cachedKeys [][]byte
+	ch := New(append(opts[:len(opts):len(opts)], func(o *options) {
+		cachedKeys, o.cachedKeys, o.members = o.cachedKeys, nil, nil
+	})...)
+	ch.lock()
+	defer ch.unlock()
+	if !ch.fits(len(v.nodes)) {
+		return ch
+	}
+
+	ch.hashFunc.Store(v.hash)
+	ch.ringSize = v.ringSize
+	ch.multiProbe = v.multiProbe
+	ch.allowEmptyKeys = v.allowEmptyKeys
+	ch.replicaJitter = v.replicaJitter
+	ch.jitterSeed = v.jitterSeed
+	ch.nodeHasher = v.nodeHasher
+	ch.cacheKeys(cachedKeys)
+	for originalHash, item := range v.items {
+		if ch.copyKeys {
+			item = append(make([]byte, 0, len(item)), item...)
+		}
+		ch.hashMap[originalHash] = item
+		ch.setReplicas(originalHash, v.replicas[originalHash])
+		if ch.addedAt != nil {
+			ch.addedAt[originalHash] = time.Now()
+		}
+	}
+	if len(v.salts) > 0 {
+		ch.salts = make(map[uint32]uint32, len(v.salts))
+		for originalHash, salt := range v.salts {
+			ch.salts[originalHash] = salt
+		}
+	}
+	if len(v.chains) > 0 {
+		if ch.chains == nil {
+			ch.chains = make(map[uint32][]uint32, len(v.chains))
+		}
+		for originalHash, chain := range v.chains {
+			ch.chains[originalHash] = append([]uint32(nil), chain...)
+		}
+	}
+	// the nodes are sorted, so each one is appended to its block
+	ch.addNodes(v.nodes)
+	return ch
+}
+
+// Len returns the number of items in the view
+func (v *RingView) Len() int {
+	return len(v.items)
+}
+
+// Members returns the items in the view sorted by their bytes
+func (v *RingView) Members() [][]byte {
+	members := make([][]byte, 0, len(v.items))
+	for _, item := range v.items {
+		members = append(members, item)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return bytes.Compare(members[i], members[j]) < 0
+	})
+	return members
+}
+
+// Get finds the closest item to the key in the view the same way as Get of the ring, except the pinned keys
+func (v *RingView) Get(key []byte) []byte {
+	if len(v.nodes) == 0 || (!v.allowEmptyKeys && len(key) == 0) {
+		return nil
+	}
+	hash := fold(v.hash(key), v.ringSize)
+	idx := v.closest(hash)
+	if v.multiProbe > 1 {
+		hash = v.nodes[idx].key
+	}
+	// like Get, the item of the exact hash is found before another item with a position at the same hash
+	if item, ok := v.items[hash]; ok {
+		return item
+	}
+	return v.items[v.nodes[idx].pointer]
+}
+
+// Shares returns the share of the circle each item owns, the shares add up to 1
+func (v *RingView) Shares() map[string]float64 {
+	shares := make(map[string]float64, len(v.items))
+	if len(v.nodes) == 0 {
+		return shares
+	}
+	// each position owns the arc after the previous position, the first one owns the arc after the last one
+	previous := v.nodes[len(v.nodes)-1].key
+	for _, n := range v.nodes {
+		arc := arcOf(previous, n.key, v.ringSize)
+		if len(v.nodes) == 1 {
+			arc = v.ringSize
+		}
+		shares[string(v.items[n.pointer])] += float64(arc) / float64(v.ringSize)
+		previous = n.key
+	}
+	return shares
+}
+
+// closest returns the index of the closest position to the hash, probing like the ring WithMultiProbe
+func (v *RingView) closest(hash uint32) int {
+	best := v.search(hash)
+	if v.multiProbe < 2 {
+		return best
+	}
+	closest := arcOf(hash, v.nodes[best].key, v.ringSize)
+	for i := 1; i < v.multiProbe; i++ {
+		h := fold(fmix32(hash+uint32(i)*probeStep), v.ringSize)
+		idx := v.search(h)
+		// the distance wraps around the end of the circle
+		if distance := arcOf(h, v.nodes[idx].key, v.ringSize); distance < closest {
+			best, closest = idx, distance
+		}
+	}
+	return best
+}
+
+// search returns the index of the first position not less than the hash, wrapping around to the first position
+func (v *RingView) search(hash uint32) int {
+	idx := sort.Search(len(v.nodes), func(i int) bool {
+		return v.nodes[i].key >= hash
+	})
+	if idx == len(v.nodes) {
+		return 0
+	}
+	return idx
+}
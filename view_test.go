@@ -0,0 +1,131 @@
+package consistenthash
+
+import (
+	"fmt"
+	"hash/crc32"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotView(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithMultiProbe(5)}} {
+		hash := New(append(opts, WithDefaultReplicas(10), WithBlockPartitioning(2))...)
+		for i := 0; i < 20; i++ {
+			hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+		}
+
+		view := hash.SnapshotView()
+		for i := 0; i < 1000; i++ {
+			key := []byte(fmt.Sprintf("key-%d", i))
+			if item, expected := view.Get(key), hash.Get(key); string(item) != string(expected) {
+				t.Fatalf("expected %s for %s, got %s", expected, key, item)
+			}
+		}
+		members, shares := view.Members(), view.Shares()
+
+		// the view doesn't change with the ring
+		hash.Remove([]byte("node-3"))
+		hash.Add([]byte("node-20"), []byte("node-21"))
+		if view.Len() != 20 || !reflect.DeepEqual(view.Members(), members) || !reflect.DeepEqual(view.Shares(), shares) {
+			t.Errorf("expected the view not to change with the ring")
+		}
+		var total float64
+		for _, share := range shares {
+			total += share
+		}
+		if math.Abs(total-1) > 1e-9 || shares["node-3"] == 0 {
+			t.Errorf("expected the shares of all the items adding up to 1, got %v", shares)
+		}
+		if after := hash.SnapshotView(); after.Len() != 21 || after.Shares()["node-3"] != 0 {
+			t.Errorf("expected a new view to see the changes")
+		}
+	}
+
+	if view := New().SnapshotView(); view.Get([]byte("key")) != nil || view.Len() != 0 || len(view.Shares()) != 0 {
+		t.Errorf("expected an empty view of an empty ring")
+	}
+}
+
+func TestNewFromSnapshot(t *testing.T) {
+	nodeHasher := func(key []byte, index uint32) uint32 {
+		return crc32.ChecksumIEEE(append([]byte(fmt.Sprintf("%d#", index)), key...))
+	}
+	for _, opts := range [][]Option{
+		nil,
+		{WithMurmur32(), WithCollisionChaining()},
+		{WithRingSize(1 << 16), WithArrayTable()},
+		{WithReplicaJitter(42), WithVirtualNodeHasher(nodeHasher), WithAllowEmptyKeys(true)},
+	} {
+		hash := New(append(opts, WithDefaultReplicas(10))...)
+		for i := 0; i < 100; i++ {
+			hash.Add([]byte(fmt.Sprintf("node-%d", i)))
+		}
+		hash.AddReplicas(50, []byte("heavy"))
+		hash.Rehash([]byte("node-7"))
+
+		// the options of the copy don't change the routing
+		copied := NewFromSnapshot(hash.SnapshotView(), WithDefaultReplicas(3), WithBlockPartitioning(2))
+		if err := copied.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if copied.Fingerprint() != hash.Fingerprint() {
+			t.Fatalf("expected the same positions and items")
+		}
+		for i := 0; i < 10000; i++ {
+			key := []byte(fmt.Sprintf("key-%d", i))
+			if item, expected := copied.Get(key), hash.Get(key); string(item) != string(expected) {
+				t.Fatalf("expected %s for %s, got %s", expected, key, item)
+			}
+		}
+
+		// both rings change the same way
+		for _, key := range []string{"heavy", "node-7", "node-42"} {
+			if !hash.Remove([]byte(key)) || !copied.Remove([]byte(key)) {
+				t.Fatalf("expected %s to be removed from both rings", key)
+			}
+		}
+		hash.AddReplicas(10, []byte("node-100"))
+		copied.AddReplicas(10, []byte("node-100"))
+		if item, expected := copied.Get(nil), hash.Get(nil); string(item) != string(expected) {
+			t.Errorf("expected %s for the empty key, got %s", expected, item)
+		}
+		if copied.Fingerprint() != hash.Fingerprint() {
+			t.Errorf("expected the same positions and items after changing both rings")
+		}
+	}
+
+	if copied := NewFromSnapshot(New().SnapshotView()); !copied.IsEmpty() {
+		t.Errorf("expected an empty ring from an empty view")
+	}
+
+	// the members of the options are not mixed in and the cached keys are hashed by the hash function of the view
+	hash := New(WithMurmur32(), WithDefaultReplicas(10), WithMembers([]byte("Bill"), []byte("Bob")))
+	copied := NewFromSnapshot(hash.SnapshotView(), WithMembers([]byte("Bonny")), WithResultCache([][]byte{[]byte("key")}))
+	if copied.Fingerprint() != hash.Fingerprint() {
+		t.Errorf("expected the members of the options to be ignored")
+	}
+	if _, ok := copied.cache[murmur32([]byte("key"))]; !ok || len(copied.cache) != 1 {
+		t.Errorf("expected the cached key to be hashed by the hash function of the view")
+	}
+}
+
+func TestSnapshotViewExactMatch(t *testing.T) {
+	// the second replica of Bill is at the hash of Bob
+	positions := map[string]uint32{"Bill": 50, "Bob": 100}
+	hash := New(WithDefaultReplicas(2), WithHashFunc(func(key []byte) uint32 {
+		return positions[string(key)]
+	}), WithVirtualNodeHasher(func(key []byte, index uint32) uint32 {
+		return 100
+	}))
+	for _, order := range [][]string{{"Bill", "Bob"}, {"Bob", "Bill"}} {
+		hash.Remove([]byte("Bill"))
+		hash.Remove([]byte("Bob"))
+		hash.Add([]byte(order[0]))
+		hash.Add([]byte(order[1]))
+		view := hash.SnapshotView()
+		if item, expected := view.Get([]byte("Bob")), hash.Get([]byte("Bob")); string(item) != "Bob" || string(expected) != "Bob" {
+			t.Errorf("expected Bob from the view and the ring, got %s and %s", item, expected)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package consistenthash
+
+import "sort"
+
+// weightedCandidates number of distinct items considered by GetNWeighted for each returned item
+const weightedCandidates = 2
+
+// GetNWeighted finds up to n distinct items for the key like GetN, preferring heavier items over nearer ones
+// the 2n closest distinct items clockwise are ordered by (distance + 1) / replicas, where distance is the length
+// of the arc from the hash of the key to the closest position of the item, so an item with twice the replicas
+// outranks a nearer one as long as it's less than about twice as far. Ties keep the clockwise order
+func (ch *ConsistentHash) GetNWeighted(key []byte, n int) [][]byte {
+	if n < 1 || (!ch.allowEmptyKeys && len(key) == 0) {
+		return nil
+	}
+
+	hash, ok := ch.hashSafely(key)
+	if !ok {
+		return nil
+	}
+
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	if ch.totalKeys == 0 {
+		return nil
+	}
+	type candidate struct {
+		item  []byte
+		score float64
+	}
+	start := ch.probe(hash)
+	limit := n * weightedCandidates
+	candidates := make([]candidate, 0, limit)
+	visited := make([]uint32, 0, limit)
+	ch.walk(start, func(blockNumber uint32, idx int) bool {
+		position := ch.blocks[blockNumber][idx]
+		if containsPointer(visited, position.pointer) {
+			return true
+		}
+		visited = append(visited, position.pointer)
+		distance := arcOf(start, position.key, ch.ringSize)
+		candidates = append(candidates, candidate{
+			item:  ch.valueOf(blockNumber, idx),
+			score: float64(distance+1) / float64(ch.replicasOf(position.pointer)),
+		})
+		return len(candidates) < limit
+	})
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score < candidates[j].score
+	})
+	if n > len(candidates) {
+		n = len(candidates)
+	}
+	items := make([][]byte, n)
+	for i := range items {
+		items[i] = candidates[i].item
+	}
+	return items
+}
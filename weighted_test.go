@@ -0,0 +1,35 @@
+package consistenthash
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGetNWeighted(t *testing.T) {
+	positions := map[string]uint32{"light": 1000, "heavy": 1001, "far": 5000, "key-1": 900, "key-2": 4900}
+	hash := New(
+		WithHashFunc(func(data []byte) uint32 { return positions[string(data)] }),
+		// the other replicas are far from the keys
+		WithVirtualNodeHasher(func(key []byte, index uint32) uint32 { return 1<<31 + positions[string(key)] + index }),
+	)
+	hash.AddReplicas(1, []byte("light"), []byte("far"))
+	hash.AddReplicas(4, []byte("heavy"))
+
+	if got := fmt.Sprintf("%s", hash.GetN([]byte("key-1"), 3)); got != "[light heavy far]" {
+		t.Fatalf("expected the closest items first, got %s", got)
+	}
+	// heavy is about as close as light, with more replicas
+	if got := fmt.Sprintf("%s", hash.GetNWeighted([]byte("key-1"), 3)); got != "[heavy light far]" {
+		t.Errorf("expected the heavier item first, got %s", got)
+	}
+	// heavy is much farther than far, the replicas don't make up for it
+	if got := fmt.Sprintf("%s", hash.GetNWeighted([]byte("key-2"), 2)); got != "[far heavy]" {
+		t.Errorf("expected the nearer item first, got %s", got)
+	}
+	if got := hash.GetNWeighted([]byte("key-1"), 10); len(got) != 3 {
+		t.Errorf("expected all 3 items, got %s", got)
+	}
+	if got := New().GetNWeighted([]byte("key-1"), 3); got != nil {
+		t.Errorf("expected nil for an empty ring, got %s", got)
+	}
+}